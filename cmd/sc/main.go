@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 
 	"github.com/google/gops/agent"
 	"github.com/spf13/cobra"
@@ -12,16 +14,22 @@ import (
 	"github.com/uvasoftware/scanii-cli/internal/commands/profile"
 	"github.com/uvasoftware/scanii-cli/internal/commands/server"
 	"github.com/uvasoftware/scanii-cli/internal/log"
+	"github.com/uvasoftware/scanii-cli/internal/telemetry"
 	"github.com/uvasoftware/scanii-cli/internal/terminal"
 
 	"log/slog"
 	"os"
+	"os/signal"
 	"runtime/debug"
+	"syscall"
+	"time"
 )
 
 var (
 	verbose    bool
 	profileArg string
+	tracing    telemetry.Options
+	shutdown   telemetry.ShutdownFunc
 
 	// These variables are set in the build step
 	version = "dev"     //nolint
@@ -48,8 +56,22 @@ func main() {
 			cmd.SilenceUsage = true
 			cmd.SilenceErrors = true
 
+			tracing.ServiceName = "sc"
+			if cmd.Name() == "server" {
+				tracing.ServiceName = "sc-server"
+			}
+			tracing.Version = version
+			var err error
+			shutdown, err = telemetry.Setup(cmd.Context(), tracing)
+			if err != nil {
+				terminal.Warn(fmt.Sprintf("tracing disabled: %s", err))
+			}
+
+			// commands stopping cleanly once ctx is cancelled by an interrupt
+			// have the agent closed when they return, the rest exit right away
+			_, handlesSignals := cmd.Annotations[file.HandlesSignalsAnnotation]
 			if err := agent.Listen(agent.Options{
-				ShutdownCleanup: true,
+				ShutdownCleanup: !handlesSignals,
 			}); err != nil {
 				panic(err)
 			}
@@ -73,10 +95,18 @@ func main() {
 		},
 	}
 
-	ctx := context.Background()
+	// an interrupt cancels ctx, a second one exits right away
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "verbose output")
 	rootCmd.PersistentFlags().StringVarP(&profileArg, "profile", "p", "default", "profile to use")
+	rootCmd.PersistentFlags().StringVar(&tracing.Endpoint, "trace-endpoint", "", "OTLP/HTTP collector to export traces to, e.g. localhost:4318")
+	rootCmd.PersistentFlags().BoolVar(&tracing.Insecure, "trace-insecure", false, "Export traces without TLS")
+	rootCmd.PersistentFlags().StringVar(&tracing.File, "trace-file", "", "File to append exported traces to as JSON")
 	rootCmd.AddCommand(profile.Command())
 	rootCmd.AddCommand(account.Command(ctx, &profileArg))
 	rootCmd.AddCommand(file.Command(ctx, &profileArg))
@@ -85,9 +115,24 @@ func main() {
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(server.Command())
 
-	err := rootCmd.Execute()
+	err := rootCmd.ExecuteContext(ctx)
+	stop()
+	agent.Close()
+	if shutdown != nil {
+		// traces are flushed even when the run was interrupted
+		flushCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+		if err := shutdown(flushCtx); err != nil {
+			slog.Warn("failed to flush traces", "error", err)
+		}
+		cancel()
+	}
 	if err != nil {
 		terminal.Error(err.Error())
+		// commands can request a specific status, such as a failed scan policy
+		var coded interface{ ExitCode() int }
+		if errors.As(err, &coded) {
+			os.Exit(coded.ExitCode())
+		}
 		os.Exit(1)
 	}
 }
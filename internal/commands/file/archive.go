@@ -0,0 +1,253 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+)
+
+// Defaults bounding how much a single archive may expand to.
+const (
+	defaultArchiveMaxEntries = 10_000
+	defaultArchiveMaxSize    = byteSize(1 << 30)
+)
+
+// memberSeparator joins an archive path and a member path, as in
+// archive.zip!/dir/file.exe.
+const memberSeparator = "!/"
+
+// archiveLimits guard against archives that expand to far more than their
+// own size, zip bombs being the usual example.
+type archiveLimits struct {
+	maxEntries int
+	// maxSize is the most an archive may expand to, counted in bytes
+	// actually extracted rather than sizes claimed by headers
+	maxSize byteSize
+}
+
+// isArchive reports whether path names an archive that can be expanded.
+func isArchive(p string) bool {
+	name := strings.ToLower(p)
+	for _, ext := range []string{".zip", ".tar", ".tar.gz", ".tgz"} {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+func memberPath(archive, name string) string {
+	return archive + memberSeparator + name
+}
+
+// expander extracts archive members to a temporary directory so they can be
+// uploaded like any other file. Members are tracked by their display path
+// and are written under generated names, never under the names the archive
+// claims. It is safe for concurrent use.
+type expander struct {
+	limits archiveLimits
+	dir    string
+
+	mu      sync.Mutex
+	next    int
+	members map[string]archiveMember
+}
+
+// archiveMember is an extracted member and its name within the archive.
+type archiveMember struct {
+	file string
+	name string
+}
+
+func newExpander(limits archiveLimits) (*expander, error) {
+	dir, err := os.MkdirTemp("", "scanii-archive-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	return &expander{limits: limits, dir: dir, members: map[string]archiveMember{}}, nil
+}
+
+// extracted tracks the members of one archive while it is being expanded.
+type extracted struct {
+	e       *expander
+	archive string
+	entries int
+	size    int64
+	files   map[string]string
+	order   []string
+}
+
+// add copies a member out of the archive, enforcing the limits.
+func (x *extracted) add(name string, r io.Reader) error {
+	name = strings.TrimPrefix(path.Clean("/"+filepath.ToSlash(name)), "/")
+	if name == "" || name == "." {
+		return nil
+	}
+
+	x.entries++
+	if x.e.limits.maxEntries > 0 && x.entries > x.e.limits.maxEntries {
+		return fmt.Errorf("archive has more than %d entries", x.e.limits.maxEntries)
+	}
+
+	x.e.mu.Lock()
+	x.e.next++
+	file := filepath.Join(x.e.dir, strconv.Itoa(x.e.next))
+	x.e.mu.Unlock()
+
+	fd, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	src := r
+	if x.e.limits.maxSize > 0 {
+		// one byte past the limit is enough to know it was exceeded
+		src = io.LimitReader(r, int64(x.e.limits.maxSize)-x.size+1)
+	}
+	n, err := io.Copy(fd, src)
+	if cerr := fd.Close(); err == nil {
+		err = cerr
+	}
+	x.files[name] = file
+	x.order = append(x.order, name)
+	if err != nil {
+		return fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	x.size += n
+	if x.e.limits.maxSize > 0 && x.size > int64(x.e.limits.maxSize) {
+		return fmt.Errorf("archive expands to more than %s", terminal.FormatBytes(uint64(x.e.limits.maxSize)))
+	}
+	return nil
+}
+
+// expand extracts every regular file in archive and returns the display
+// paths of its members. Nothing is returned when a limit is exceeded or the
+// archive is damaged, so a partially read archive is never reported as clean.
+func (e *expander) expand(archive string) ([]string, error) {
+	x := &extracted{e: e, archive: archive, files: map[string]string{}}
+
+	var err error
+	if strings.HasSuffix(strings.ToLower(archive), ".zip") {
+		err = x.zip()
+	} else {
+		err = x.tar()
+	}
+	if err != nil {
+		for _, file := range x.files {
+			_ = os.Remove(file)
+		}
+		return nil, err
+	}
+
+	members := make([]string, 0, len(x.order))
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	for _, name := range x.order {
+		p := memberPath(archive, name)
+		if _, ok := e.members[p]; ok {
+			// repeated names are listed once, files holds the last copy as unpacking would
+			continue
+		}
+		e.members[p] = archiveMember{file: x.files[name], name: name}
+		members = append(members, p)
+	}
+	return members, nil
+}
+
+func (x *extracted) zip() error {
+	zr, err := zip.OpenReader(x.archive)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = zr.Close() }()
+
+	// duplicate names are written in order so the last one wins
+	for _, f := range zr.File {
+		if !f.Mode().IsRegular() {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return err
+		}
+		err = x.add(f.Name, rc)
+		_ = rc.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *extracted) tar() error {
+	fd, err := os.Open(x.archive)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = fd.Close() }()
+
+	var r io.Reader = fd
+	name := strings.ToLower(x.archive)
+	if strings.HasSuffix(name, ".gz") || strings.HasSuffix(name, ".tgz") {
+		gz, err := gzip.NewReader(fd)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = gz.Close() }()
+		r = gz
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		h, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if h.Typeflag != tar.TypeReg {
+			continue
+		}
+		if err := x.add(h.Name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+// lookup returns the extracted file and member name behind a display path.
+func (e *expander) lookup(p string) (file, member string, ok bool) {
+	if e == nil {
+		return "", "", false
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	m, ok := e.members[p]
+	return m.file, m.name, ok
+}
+
+// release removes a member once its result is final.
+func (e *expander) release(p string) {
+	e.mu.Lock()
+	m, ok := e.members[p]
+	delete(e.members, p)
+	e.mu.Unlock()
+	if ok {
+		_ = os.Remove(m.file)
+	}
+}
+
+// close removes everything extracted.
+func (e *expander) close() error {
+	return os.RemoveAll(e.dir)
+}
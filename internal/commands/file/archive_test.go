@@ -0,0 +1,202 @@
+package file
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func writeZip(t *testing.T, files map[string]string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "archive.zip")
+	fd, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("create: %s", err)
+	}
+	zw := zip.NewWriter(fd)
+	for name, content := range files {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("zip: %s", err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatalf("zip close: %s", err)
+	}
+	_ = fd.Close()
+	return p
+}
+
+func writeTarGz(t *testing.T, files map[string]string) string {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "archive.tar.gz")
+	fd, err := os.Create(p)
+	if err != nil {
+		t.Fatalf("create: %s", err)
+	}
+	gz := gzip.NewWriter(fd)
+	tw := tar.NewWriter(gz)
+	_ = tw.WriteHeader(&tar.Header{Name: "dir/", Typeflag: tar.TypeDir, Mode: 0755})
+	for name, content := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0600, Size: int64(len(content))}); err != nil {
+			t.Fatalf("tar: %s", err)
+		}
+		_, _ = tw.Write([]byte(content))
+	}
+	_ = tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"})
+	_ = tw.Close()
+	_ = gz.Close()
+	_ = fd.Close()
+	return p
+}
+
+func expandAll(t *testing.T, e *expander, archive string) map[string]string {
+	t.Helper()
+	members, err := e.expand(archive)
+	if err != nil {
+		t.Fatalf("expand: %s", err)
+	}
+	contents := map[string]string{}
+	for _, m := range members {
+		file, name, ok := e.lookup(m)
+		if !ok {
+			t.Fatalf("member %s not found", m)
+		}
+		if m != memberPath(archive, name) {
+			t.Errorf("unexpected member path %s for %s", m, name)
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatalf("read: %s", err)
+		}
+		contents[name] = string(data)
+	}
+	return contents
+}
+
+func TestExpanderArchives(t *testing.T) {
+	files := map[string]string{"dir/a.txt": "alpha", "b.exe": "beta", "../../escape.txt": "gamma"}
+	for _, archive := range []string{writeZip(t, files), writeTarGz(t, files)} {
+		e, err := newExpander(archiveLimits{})
+		if err != nil {
+			t.Fatalf("new: %s", err)
+		}
+		got := expandAll(t, e, archive)
+		var names []string
+		for name := range got {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if strings.Join(names, ",") != "b.exe,dir/a.txt,escape.txt" {
+			t.Errorf("%s: unexpected members %v", archive, names)
+		}
+		if got["dir/a.txt"] != "alpha" {
+			t.Errorf("%s: unexpected content %q", archive, got["dir/a.txt"])
+		}
+
+		m := memberPath(archive, "b.exe")
+		e.release(m)
+		if _, _, ok := e.lookup(m); ok {
+			t.Error("expected a released member to be gone")
+		}
+		if err := e.close(); err != nil {
+			t.Fatalf("close: %s", err)
+		}
+		if _, err := os.Stat(e.dir); !os.IsNotExist(err) {
+			t.Error("expected the extraction directory to be removed")
+		}
+	}
+}
+
+func TestExpanderLimits(t *testing.T) {
+	archive := writeZip(t, map[string]string{"a": strings.Repeat("a", 600), "b": strings.Repeat("b", 600), "c": "c"})
+
+	for name, limits := range map[string]archiveLimits{
+		"entries": {maxEntries: 2},
+		"size":    {maxSize: 1000},
+	} {
+		e, err := newExpander(limits)
+		if err != nil {
+			t.Fatalf("new: %s", err)
+		}
+		members, err := e.expand(archive)
+		if err == nil || len(members) != 0 {
+			t.Errorf("%s: expected the archive to be rejected, got %v", name, members)
+		}
+		entries, _ := os.ReadDir(e.dir)
+		if len(entries) != 0 {
+			t.Errorf("%s: expected partial members to be removed, got %d", name, len(entries))
+		}
+		_ = e.close()
+	}
+}
+
+func TestExpanderDamagedArchive(t *testing.T) {
+	p := filepath.Join(t.TempDir(), "broken.zip")
+	if err := os.WriteFile(p, []byte("not a zip"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	e, err := newExpander(archiveLimits{})
+	if err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	defer func() { _ = e.close() }()
+	if _, err := e.expand(p); err == nil {
+		t.Error("expected an error for a damaged archive")
+	}
+}
+
+func TestServiceProcessArchiveMembers(t *testing.T) {
+	sample, err := os.ReadFile(fakeMalwareSample)
+	if err != nil {
+		t.Fatalf("read sample: %s", err)
+	}
+	archive := writeZip(t, map[string]string{"bin/sample": string(sample), "clean.txt": "nothing here"})
+
+	svc := newTestService(t)
+	if svc.archives, err = newExpander(archiveLimits{}); err != nil {
+		t.Fatalf("new: %s", err)
+	}
+	defer func() { _ = svc.archives.close() }()
+	members, err := svc.archives.expand(archive)
+	if err != nil {
+		t.Fatalf("expand: %s", err)
+	}
+
+	stream := make(chan string, len(members))
+	for _, m := range members {
+		stream <- m
+	}
+	close(stream)
+
+	results := map[string]resultRecord{}
+	var mu sync.Mutex
+	err = svc.process(context.Background(), stream, 2, "", false, nil, func(r resultRecord) {
+		mu.Lock()
+		results[r.path] = r
+		mu.Unlock()
+	})
+	if err != nil {
+		t.Fatalf("process failed: %s", err)
+	}
+
+	r, ok := results[archive+"!/bin/sample"]
+	if !ok {
+		t.Fatalf("expected a result for the member, got %v", results)
+	}
+	checkResponseContent(t, &r)
+	if r.metadata["archive_member"] != "bin/sample" {
+		t.Errorf("expected the member path in metadata, got %v", r.metadata)
+	}
+	if clean := results[archive+"!/clean.txt"]; clean.err != nil || len(clean.findings) != 0 {
+		t.Errorf("expected clean.txt to be clean, got %+v", clean)
+	}
+}
@@ -0,0 +1,179 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/uvasoftware/scanii-cli/internal/client"
+)
+
+// Defaults for waiting on async results.
+const (
+	defaultPollInterval = time.Second
+	defaultPollMaxDelay = 15 * time.Second
+	defaultWaitTimeout  = 15 * time.Minute
+)
+
+// errPending marks a result that is not available yet, errNotFound an id
+// the API does not know about, which is also the case shortly after a
+// submission.
+var (
+	errPending  = errors.New("result is not available yet")
+	errNotFound = errors.New("not found")
+)
+
+// processingRecord converts a processing result returned by the API.
+func processingRecord(pr *client.ProcessingResponse) resultRecord {
+	var r resultRecord
+	if pr == nil {
+		return r
+	}
+	if pr.ID != nil {
+		r.id = *pr.ID
+	}
+	if pr.ContentType != nil {
+		r.contentType = *pr.ContentType
+	}
+	if pr.Checksum != nil {
+		r.checksum = *pr.Checksum
+	}
+	if pr.Findings != nil {
+		r.findings = *pr.Findings
+	}
+	if pr.ContentLength != nil {
+		r.contentLength = uint64(*pr.ContentLength)
+	}
+	if pr.CreationDate != nil {
+		r.creationDate = *pr.CreationDate
+	}
+	if pr.Metadata != nil {
+		r.metadata = *pr.Metadata
+	}
+	if pr.Error != nil {
+		r.err = fmt.Errorf("error retrieving file with id %s: %s", r.id, *pr.Error)
+	}
+	return r
+}
+
+// poller waits for the results of async submissions, polling every pending
+// id with backoff until it completes. It is safe for concurrent use.
+type poller struct {
+	s *service
+	// policy spaces the polls of each id, its retries are not used
+	policy retryPolicy
+	// timeout bounds how long a single id is waited on, zero is unlimited
+	timeout time.Duration
+	// slots bounds the requests in flight across every id
+	slots chan struct{}
+	wg    sync.WaitGroup
+}
+
+func newPoller(s *service, policy retryPolicy, timeout time.Duration, concurrency int) *poller {
+	return &poller{s: s, policy: policy, timeout: timeout, slots: make(chan struct{}, max(concurrency, 1))}
+}
+
+// wait hands the completed result of pending to consumer once it is in.
+func (p *poller) wait(ctx context.Context, pending resultRecord, consumer consumer) {
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		consumer(p.await(ctx, pending))
+	}()
+}
+
+// close blocks until every result passed to wait has been consumed.
+func (p *poller) close() {
+	p.wg.Wait()
+}
+
+// await polls for the result of pending, a failed record is returned when
+// it cannot be retrieved or the timeout passes first.
+func (p *poller) await(ctx context.Context, pending resultRecord) resultRecord {
+	ctx, span := tracer.Start(ctx, "files.await")
+	defer span.End()
+
+	started := time.Now()
+	deadline := time.Time{}
+	if p.timeout > 0 {
+		deadline = started.Add(p.timeout)
+	}
+
+	for attempt := 1; ; attempt++ {
+		r, t := p.check(ctx, pending.id)
+		if t == nil {
+			// the submission is what identifies the file locally
+			r.path = pending.path
+			r.location = pending.location
+			r.retries = pending.retries
+			r.elapsed = pending.elapsed + time.Since(started)
+			return r
+		}
+
+		delay := p.policy.backoff(attempt, t)
+		if !deadline.IsZero() && time.Now().Add(delay).After(deadline) {
+			// the last reason is kept so callers can tell pending from unknown ids
+			pending.err = fmt.Errorf("timed out waiting for the result of %s after %s: %w", pending.id, p.timeout, r.err)
+			return pending
+		}
+		slog.Debug("waiting for result", "id", pending.id, "attempt", attempt, "delay", delay, "reason", r.err)
+		if !wait(ctx, delay) {
+			pending.err = ctx.Err()
+			return pending
+		}
+	}
+}
+
+// check retrieves the result of id once, a transient is returned while it
+// is still pending or the request failed in a way worth trying again.
+func (p *poller) check(ctx context.Context, id string) (resultRecord, *transient) {
+	r := resultRecord{id: id}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		r.err = ctx.Err()
+		return r, nil
+	}
+	defer func() { <-p.slots }()
+
+	if err := p.s.requests.wait(ctx, 1); err != nil {
+		r.err = err
+		return r, nil
+	}
+	resp, err := p.s.client.RetrieveFile(ctx, id)
+	if err != nil {
+		r.err = err
+		if retryableError(err) {
+			return r, &transient{}
+		}
+		return r, nil
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		r.err = fmt.Errorf("processing id %s %w", id, errNotFound)
+		return r, &transient{}
+	case retryableStatus(resp.StatusCode):
+		r.err = fmt.Errorf("error retrieving file with id %s, status code %d", id, resp.StatusCode)
+		return r, &transient{retryAfter: parseRetryAfter(resp.Header)}
+	case resp.StatusCode != http.StatusOK:
+		r.err = fmt.Errorf("error retrieving file with id %s, status code %d", id, resp.StatusCode)
+		return r, nil
+	}
+
+	r = processingRecord(resp.Result)
+	if r.id == "" {
+		r.id = id
+	}
+	// a result has a checksum once processing is complete
+	if r.checksum == "" && r.err == nil {
+		r.err = errPending
+		return r, &transient{}
+	}
+	return r, nil
+}
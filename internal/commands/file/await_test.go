@@ -0,0 +1,148 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// pendingService returns a service whose result lookups are answered by
+// pending until it returns false, after which they reach the mock server.
+func pendingService(t *testing.T, pending func(w http.ResponseWriter, polls int32) bool) (*service, *atomic.Int32) {
+	t.Helper()
+	upstream, _ := url.Parse("http://" + ts.Endpoint)
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	polls := &atomic.Int32{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && strings.Contains(r.URL.Path, "/files/") && pending(w, polls.Add(1)) {
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	p := *ts.Profile
+	p.Endpoint = "localhost:" + srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	svc, err := newService(&p)
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	return svc, polls
+}
+
+// submitOne submits a single path asynchronously and returns its pending record.
+func submitOne(t *testing.T, svc *service, path string) resultRecord {
+	t.Helper()
+	stream := make(chan string, 1)
+	stream <- path
+	close(stream)
+
+	var result resultRecord
+	if err := svc.process(context.Background(), stream, 1, "", true, nil, func(r resultRecord) { result = r }); err != nil {
+		t.Fatalf("process failed: %s", err)
+	}
+	if result.err != nil || result.id == "" {
+		t.Fatalf("expected a pending id, got %+v", result)
+	}
+	return result
+}
+
+var fastPolls = retryPolicy{delay: time.Millisecond, maxDelay: 5 * time.Millisecond}
+
+func TestPollerWaitsForPendingResults(t *testing.T) {
+	svc, polls := pendingService(t, func(w http.ResponseWriter, polls int32) bool {
+		switch polls {
+		case 1:
+			w.WriteHeader(http.StatusNotFound)
+		case 2:
+			// accepted but not processed yet, there is no checksum
+			_, _ = fmt.Fprint(w, `{"id":"pending"}`)
+		case 3:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			return false
+		}
+		return true
+	})
+	pending := submitOne(t, svc, fakeMalwareSample)
+
+	p := newPoller(svc, fastPolls, time.Minute, 4)
+	r := p.await(context.Background(), pending)
+	if r.err != nil {
+		t.Fatalf("expected a result, got %s", r.err)
+	}
+	checkResponseContent(t, &r)
+	if r.path != fakeMalwareSample || r.id != pending.id {
+		t.Errorf("expected the submission's path and id to be kept, got %s %s", r.path, r.id)
+	}
+	if polls.Load() != 4 {
+		t.Errorf("expected 4 polls, got %d", polls.Load())
+	}
+}
+
+func TestPollerTimesOut(t *testing.T) {
+	svc, _ := pendingService(t, func(w http.ResponseWriter, _ int32) bool {
+		w.WriteHeader(http.StatusNotFound)
+		return true
+	})
+	pending := submitOne(t, svc, fakeMalwareSample)
+
+	p := newPoller(svc, fastPolls, 20*time.Millisecond, 1)
+	r := p.await(context.Background(), pending)
+	if r.err == nil || !strings.Contains(r.err.Error(), "timed out") {
+		t.Fatalf("expected a timeout, got %v", r.err)
+	}
+	if r.path != fakeMalwareSample {
+		t.Errorf("expected the path to be kept, got %s", r.path)
+	}
+}
+
+func TestPollerStopsOnClientErrors(t *testing.T) {
+	svc, polls := pendingService(t, func(w http.ResponseWriter, _ int32) bool {
+		w.WriteHeader(http.StatusForbidden)
+		return true
+	})
+	pending := submitOne(t, svc, fakeMalwareSample)
+
+	p := newPoller(svc, fastPolls, time.Minute, 1)
+	if r := p.await(context.Background(), pending); r.err == nil {
+		t.Fatal("expected an error")
+	}
+	if polls.Load() != 1 {
+		t.Errorf("expected a single poll, got %d", polls.Load())
+	}
+}
+
+func TestPollerWait(t *testing.T) {
+	svc := newTestService(t)
+	p := newPoller(svc, fastPolls, time.Minute, 2)
+
+	var mu sync.Mutex
+	var results []resultRecord
+	for range 5 {
+		p.wait(context.Background(), submitOne(t, svc, fakeMalwareSample), func(r resultRecord) {
+			mu.Lock()
+			results = append(results, r)
+			mu.Unlock()
+		})
+	}
+	p.close()
+
+	if len(results) != 5 {
+		t.Fatalf("expected 5 results, got %d", len(results))
+	}
+	for _, r := range results {
+		if r.err != nil || r.checksum == "" {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+}
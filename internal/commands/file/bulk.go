@@ -0,0 +1,296 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/uvasoftware/scanii-cli/internal/client"
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+	"golang.org/x/sync/errgroup"
+)
+
+// defaultLookupConcurrency bounds the ids looked up at once by retrieve and trace.
+const defaultLookupConcurrency = 8
+
+// Statuses reported for each id looked up by retrieve and trace.
+const (
+	lookupComplete = "complete"
+	lookupPending  = "pending"
+	lookupNotFound = "not found"
+	lookupFailed   = "error"
+)
+
+// idRef is a processing id to look up, along with the path it was submitted
+// from when read from a prior run's output.
+type idRef struct {
+	id   string
+	path string
+}
+
+// collectIDs merges the ids given as arguments with those read from file,
+// dropping duplicates while keeping their order.
+func collectIDs(args []string, file string) ([]idRef, error) {
+	refs := make([]idRef, 0, len(args))
+	for _, id := range args {
+		refs = append(refs, idRef{id: id})
+	}
+	if file != "" {
+		read, err := readIDs(file)
+		if err != nil {
+			return nil, err
+		}
+		refs = append(refs, read...)
+	}
+
+	seen := make(map[string]bool, len(refs))
+	unique := refs[:0]
+	for _, ref := range refs {
+		if ref.id == "" || seen[ref.id] {
+			continue
+		}
+		seen[ref.id] = true
+		unique = append(unique, ref)
+	}
+	if len(unique) == 0 {
+		return nil, errors.New("at least one id or --from-file is required")
+	}
+	return unique, nil
+}
+
+// readIDs reads processing ids from name, - reads standard input. The list
+// is either one id per line, skipping blank lines and lines starting with
+// #, or the json or ndjson output of a prior process, async or fetch run.
+func readIDs(name string) ([]idRef, error) {
+	var r io.Reader = os.Stdin
+	if name != stdinPath {
+		fd, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open id list: %w", err)
+		}
+		defer func() { _ = fd.Close() }()
+		r = fd
+	}
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read id list: %w", err)
+	}
+
+	// a json array, as written by --output json
+	if trimmed := bytes.TrimSpace(content); bytes.HasPrefix(trimmed, []byte("[")) {
+		var results []resultOutput
+		if err := json.Unmarshal(trimmed, &results); err != nil {
+			return nil, fmt.Errorf("failed to parse id list: %w", err)
+		}
+		refs := make([]idRef, 0, len(results))
+		for _, result := range results {
+			refs = appendResultID(refs, result)
+		}
+		return refs, nil
+	}
+
+	var refs []idRef
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+		case strings.HasPrefix(line, "{"):
+			var result resultOutput
+			if err := json.Unmarshal([]byte(line), &result); err != nil {
+				return nil, fmt.Errorf("failed to parse line %d of id list: %w", n, err)
+			}
+			refs = appendResultID(refs, result)
+		default:
+			refs = append(refs, idRef{id: line})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read id list: %w", err)
+	}
+	return refs, nil
+}
+
+// appendResultID adds the id of a prior result, those that failed before
+// being assigned one are skipped with a warning.
+func appendResultID(refs []idRef, result resultOutput) []idRef {
+	if result.ID == "" {
+		terminal.Warn(fmt.Sprintf("Skipping %s, it has no processing id", result.Path))
+		return refs
+	}
+	return append(refs, idRef{id: result.ID, path: result.Path})
+}
+
+// lookupStatus classifies the outcome of looking up a processing id.
+func lookupStatus(err error) string {
+	switch {
+	case err == nil:
+		return lookupComplete
+	case errors.Is(err, errNotFound):
+		return lookupNotFound
+	case errors.Is(err, errPending):
+		return lookupPending
+	}
+	return lookupFailed
+}
+
+// lookupOptions holds the settings of a bulk retrieve or trace.
+type lookupOptions struct {
+	concurrency int
+	// wait is how long each result is polled for, zero looks it up once
+	wait   time.Duration
+	output *output
+}
+
+// lookupSummary counts the outcome of every id looked up.
+type lookupSummary map[string]int
+
+func (s lookupSummary) total() int {
+	total := 0
+	for _, n := range s {
+		total += n
+	}
+	return total
+}
+
+func (s lookupSummary) print(verb string, started time.Time) {
+	terminal.Newline()
+	terminal.Success(fmt.Sprintf("%s %d of %d id(s) in %s, %d pending, %d not found and %d failed",
+		verb, s[lookupComplete], s.total(), terminal.FormatDuration(time.Since(started)), s[lookupPending], s[lookupNotFound], s[lookupFailed]))
+}
+
+// err fails the command when any id was not found or could not be looked
+// up, results still pending are not failures.
+func (s lookupSummary) err() error {
+	if n := s[lookupNotFound] + s[lookupFailed]; n > 0 {
+		return fmt.Errorf("%d of %d id(s) could not be looked up", n, s.total())
+	}
+	return nil
+}
+
+// retrieveAll retrieves the result of every id, at most concurrency at a
+// time, and reports them in the order given.
+func retrieveAll(ctx context.Context, c *client.Client, refs []idRef, opts lookupOptions) error {
+	out := opts.output
+	if out == nil {
+		out = newOutput(outputText, os.Stdout)
+	}
+	terminal.Info(fmt.Sprintf("Retrieving %s result(s)", terminal.FormatNumber(int64(len(refs)))))
+
+	started := time.Now()
+	results := make([]resultRecord, len(refs))
+	p := newPoller(&service{client: c}, retryPolicy{delay: defaultPollInterval, maxDelay: defaultPollMaxDelay}, opts.wait, opts.concurrency)
+
+	g := errgroup.Group{}
+	g.SetLimit(max(opts.concurrency, 1))
+	for i, ref := range refs {
+		g.Go(func() error {
+			pending := resultRecord{id: ref.id, path: ref.path}
+			if opts.wait > 0 {
+				results[i] = p.await(ctx, pending)
+				return nil
+			}
+			r, _ := p.check(ctx, ref.id)
+			r.path = ref.path
+			results[i] = r
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	summary := lookupSummary{}
+	rows := make([][]string, 0, len(results))
+	for i := range results {
+		r := &results[i]
+		status := lookupStatus(r.err)
+		summary[status]++
+		if out.machine() {
+			if err := out.lookup(r, status); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			continue
+		}
+		details := "none"
+		switch {
+		case r.err != nil:
+			details = r.err.Error()
+		case len(r.findings) > 0:
+			details = strings.Join(r.findings, ", ")
+		}
+		rows = append(rows, []string{r.id, r.path, status, details})
+	}
+	if err := out.close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	if !out.machine() {
+		terminal.Table([]string{"id", "path", "status", "details"}, rows)
+	}
+
+	summary.print("Retrieved", started)
+	return summary.err()
+}
+
+// traceOutcome is the trace of an id or the reason it could not be retrieved.
+type traceOutcome struct {
+	record *traceRecord
+	err    error
+}
+
+// traceAll retrieves the trace of every id, at most concurrency at a time,
+// and reports them in the order given.
+func traceAll(ctx context.Context, c *client.Client, refs []idRef, opts lookupOptions) error {
+	out := opts.output
+	if out == nil {
+		out = newOutput(outputText, os.Stdout)
+	}
+	terminal.Info(fmt.Sprintf("Retrieving %s trace(s)", terminal.FormatNumber(int64(len(refs)))))
+
+	started := time.Now()
+	outcomes := make([]traceOutcome, len(refs))
+
+	g := errgroup.Group{}
+	g.SetLimit(max(opts.concurrency, 1))
+	for i, ref := range refs {
+		g.Go(func() error {
+			record, err := callFileTrace(ctx, c, ref.id)
+			if record == nil {
+				record = &traceRecord{id: ref.id}
+			}
+			outcomes[i] = traceOutcome{record: record, err: err}
+			return nil
+		})
+	}
+	_ = g.Wait()
+
+	summary := lookupSummary{}
+	for _, outcome := range outcomes {
+		status := lookupStatus(outcome.err)
+		summary[status]++
+		if out.machine() {
+			if err := out.lookupTrace(outcome.record, status, outcome.err); err != nil {
+				return fmt.Errorf("failed to write output: %w", err)
+			}
+			continue
+		}
+		if outcome.err != nil {
+			terminal.Error(outcome.err.Error())
+			continue
+		}
+		printTraceResult(outcome.record)
+		terminal.Newline()
+	}
+	if err := out.close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	summary.print("Traced", started)
+	return summary.err()
+}
@@ -0,0 +1,157 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadIDs(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []idRef
+	}{
+		{
+			name:    "plain",
+			content: "# batch 1\nid1\n\n  id2  \r\n",
+			want:    []idRef{{id: "id1"}, {id: "id2"}},
+		},
+		{
+			name:    "ndjson",
+			content: `{"path":"a.txt","id":"id1","findings":[]}` + "\n" + `{"path":"b.txt","findings":[],"error":"boom"}` + "\n" + `{"path":"c.txt","id":"id3","findings":[]}` + "\n",
+			want:    []idRef{{id: "id1", path: "a.txt"}, {id: "id3", path: "c.txt"}},
+		},
+		{
+			name:    "json",
+			content: "[\n  {\"path\": \"a.txt\", \"id\": \"id1\", \"findings\": []},\n  {\"path\": \"b.txt\", \"id\": \"id2\", \"findings\": []}\n]\n",
+			want:    []idRef{{id: "id1", path: "a.txt"}, {id: "id2", path: "b.txt"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "ids")
+			if err := os.WriteFile(path, []byte(tt.content), 0600); err != nil {
+				t.Fatalf("write: %s", err)
+			}
+			refs, err := readIDs(path)
+			if err != nil {
+				t.Fatalf("readIDs: %s", err)
+			}
+			if !slices.Equal(refs, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, refs)
+			}
+		})
+	}
+}
+
+func TestCollectIDs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ids")
+	if err := os.WriteFile(path, []byte("id2\nid3\nid1\n"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	refs, err := collectIDs([]string{"id1", "id2"}, path)
+	if err != nil {
+		t.Fatalf("collectIDs: %s", err)
+	}
+	if want := []idRef{{id: "id1"}, {id: "id2"}, {id: "id3"}}; !slices.Equal(refs, want) {
+		t.Fatalf("expected %v, got %v", want, refs)
+	}
+	if _, err := collectIDs(nil, ""); err == nil {
+		t.Fatal("expected an error without ids")
+	}
+}
+
+// readLookups decodes ndjson lookup output keyed by id.
+func readLookups(t *testing.T, buf *bytes.Buffer) map[string]lookupOutput {
+	t.Helper()
+	results := map[string]lookupOutput{}
+	scanner := bufio.NewScanner(buf)
+	for scanner.Scan() {
+		var r lookupOutput
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("unmarshal: %s", err)
+		}
+		results[r.ID] = r
+	}
+	return results
+}
+
+func TestRetrieveAll(t *testing.T) {
+	complete := submitOne(t, newTestService(t), fakeMalwareSample)
+
+	// ids are looked up one at a time, the second is accepted but not
+	// processed yet so it has no checksum
+	svc, _ := pendingService(t, func(w http.ResponseWriter, polls int32) bool {
+		if polls != 2 {
+			return false
+		}
+		_, _ = fmt.Fprint(w, `{"id":"stalled"}`)
+		return true
+	})
+
+	refs := []idRef{{id: complete.id, path: "malware"}, {id: "stalled"}, {id: "doesnotexist"}}
+	buf := &bytes.Buffer{}
+	err := retrieveAll(context.Background(), svc.client, refs, lookupOptions{concurrency: 1, output: newOutput(outputNDJSON, buf)})
+	if err == nil || !strings.Contains(err.Error(), "1 of 3") {
+		t.Fatalf("expected the unknown id to fail the lookup, got %v", err)
+	}
+	results := readLookups(t, buf)
+	if len(results) != len(refs) {
+		t.Fatalf("expected a result per id, got %v", results)
+	}
+	if r := results[complete.id]; r.Status != lookupComplete || r.Checksum == "" || r.Path != "malware" {
+		t.Errorf("expected the result with its path, got %+v", r)
+	}
+	if r := results["stalled"]; r.Status != lookupPending {
+		t.Errorf("expected the result to be pending, got %+v", r)
+	}
+	if r := results["doesnotexist"]; r.Status != lookupNotFound || r.Error == "" {
+		t.Errorf("expected the unknown id not to be found, got %+v", r)
+	}
+}
+
+func TestRetrieveAllWaitTimesOut(t *testing.T) {
+	svc := newTestService(t)
+	buf := &bytes.Buffer{}
+	opts := lookupOptions{concurrency: 1, wait: 10 * time.Millisecond, output: newOutput(outputNDJSON, buf)}
+	if err := retrieveAll(context.Background(), svc.client, []idRef{{id: "doesnotexist"}}, opts); err == nil {
+		t.Fatal("expected the unknown id to fail the lookup")
+	}
+	if r := readLookups(t, buf)["doesnotexist"]; r.Status != lookupNotFound {
+		t.Errorf("expected the id not to be found once the wait is over, got %+v", r)
+	}
+}
+
+func TestTraceAll(t *testing.T) {
+	svc := newTestService(t)
+	processed := submitOne(t, svc, fakeMalwareSample)
+
+	buf := &bytes.Buffer{}
+	refs := []idRef{{id: processed.id}, {id: "doesnotexist"}}
+	if err := traceAll(context.Background(), svc.client, refs, lookupOptions{concurrency: 2, output: newOutput(outputJSON, buf)}); err == nil || !strings.Contains(err.Error(), "1 of 2") {
+		t.Fatalf("expected the unknown id to fail the trace, got %v", err)
+	}
+	var traces []traceOutput
+	if err := json.Unmarshal(buf.Bytes(), &traces); err != nil {
+		t.Fatalf("unmarshal: %s", err)
+	}
+	if len(traces) != 2 {
+		t.Fatalf("expected a trace per id, got %v", traces)
+	}
+	if traces[0].ID != processed.id || traces[0].Status != lookupComplete || len(traces[0].Events) == 0 {
+		t.Errorf("expected the trace of %s, got %+v", processed.id, traces[0])
+	}
+	if traces[1].ID != "doesnotexist" || traces[1].Status != lookupNotFound || traces[1].Error == "" {
+		t.Errorf("expected the unknown id not to be found, got %+v", traces[1])
+	}
+}
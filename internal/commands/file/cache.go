@@ -0,0 +1,208 @@
+package file
+
+import (
+	sha1hash "crypto/sha1" //nolint:gosec
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	cacheFileName   = "results.json"
+	defaultCacheTTL = 7 * 24 * time.Hour
+)
+
+// cacheEntry is a prior result along with the state of the file it was
+// produced from.
+type cacheEntry struct {
+	Size     int64             `json:"size"`
+	ModTime  time.Time         `json:"mtime"`
+	SHA1     string            `json:"sha1"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+	Stored   time.Time         `json:"stored"`
+	Result   resultOutput      `json:"result"`
+}
+
+// resultCache remembers synchronous results on disk so unchanged files are
+// not uploaded again. A file is unchanged when its path, size, modification
+// time and sha1 all match the entry, and the entry was stored with the same
+// metadata and endpoint less than ttl ago. It is safe for concurrent use.
+type resultCache struct {
+	path     string
+	endpoint string
+	ttl      time.Duration
+	hits     atomic.Uint64
+
+	mu sync.Mutex
+	// entries are keyed by endpoint and absolute file path
+	entries map[string]map[string]cacheEntry
+	dirty   bool
+}
+
+// defaultCachePath returns where results are cached when no path is given.
+func defaultCachePath() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "scanii-cli", cacheFileName), nil
+}
+
+func newResultCache(path, endpoint string, ttl time.Duration) *resultCache {
+	return &resultCache{
+		path:     path,
+		endpoint: endpoint,
+		ttl:      ttl,
+		entries:  map[string]map[string]cacheEntry{},
+	}
+}
+
+// loadResultCache reads the cache at path, a missing file is an empty cache.
+func loadResultCache(path, endpoint string, ttl time.Duration) (*resultCache, error) {
+	c := newResultCache(path, endpoint, ttl)
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("failed to parse result cache %s: %w", path, err)
+	}
+	return c, nil
+}
+
+func fileSHA1(path string) (string, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = fd.Close() }()
+
+	h := sha1hash.New() //nolint:gosec
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+func (c *resultCache) expired(e cacheEntry) bool {
+	return c.ttl > 0 && time.Since(e.Stored) > c.ttl
+}
+
+// lookup returns the cached result for path when the file is unchanged.
+func (c *resultCache) lookup(path string, metadata map[string]string) (resultRecord, bool) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return resultRecord{}, false
+	}
+
+	c.mu.Lock()
+	entry, ok := c.entries[c.endpoint][abs]
+	c.mu.Unlock()
+	if !ok || c.expired(entry) || !maps.Equal(entry.Metadata, metadata) {
+		return resultRecord{}, false
+	}
+
+	info, err := os.Stat(path)
+	if err != nil || info.Size() != entry.Size || !info.ModTime().Equal(entry.ModTime) {
+		return resultRecord{}, false
+	}
+	sum, err := fileSHA1(path)
+	if err != nil || sum != entry.SHA1 {
+		return resultRecord{}, false
+	}
+
+	c.hits.Add(1)
+	r := entry.Result.record()
+	r.path = path
+	r.cached = true
+	return r, true
+}
+
+// store remembers a successful result, info and sum describe the file as
+// it was uploaded.
+func (c *resultCache) store(path string, info os.FileInfo, sum string, metadata map[string]string, r *resultRecord) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	o := newResultOutput(r)
+	o.Path = ""
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries[c.endpoint] == nil {
+		c.entries[c.endpoint] = map[string]cacheEntry{}
+	}
+	c.entries[c.endpoint][abs] = cacheEntry{
+		Size:     info.Size(),
+		ModTime:  info.ModTime(),
+		SHA1:     sum,
+		Metadata: metadata,
+		Stored:   time.Now(),
+		Result:   o,
+	}
+	c.dirty = true
+}
+
+// save drops expired entries and writes the cache back to disk if it changed.
+func (c *resultCache) save() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for endpoint, entries := range c.entries {
+		for path, e := range entries {
+			if c.expired(e) {
+				delete(entries, path)
+				c.dirty = true
+			}
+		}
+		if len(entries) == 0 {
+			delete(c.entries, endpoint)
+		}
+	}
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.Marshal(c.entries)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return err
+	}
+
+	// write to a temp file first so an interrupted run never leaves a partial cache
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), cacheFileName+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		_ = os.Remove(tmp.Name())
+		return err
+	}
+	slog.Debug("saved result cache", "path", c.path)
+	c.dirty = false
+	return nil
+}
@@ -0,0 +1,134 @@
+package file
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func cacheSample(t *testing.T) (string, os.FileInfo, string) {
+	t.Helper()
+	p := filepath.Join(t.TempDir(), "sample.txt")
+	if err := os.WriteFile(p, []byte("sample content"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		t.Fatalf("stat: %s", err)
+	}
+	sum, err := fileSHA1(p)
+	if err != nil {
+		t.Fatalf("sha1: %s", err)
+	}
+	return p, info, sum
+}
+
+func TestResultCacheLookup(t *testing.T) {
+	p, info, sum := cacheSample(t)
+	c := newResultCache(filepath.Join(t.TempDir(), cacheFileName), "localhost:4000", time.Hour)
+	metadata := map[string]string{"m1": "v1"}
+	c.store(p, info, sum, metadata, &resultRecord{path: p, id: "abc", checksum: sum, findings: []string{"content.malicious.x"}})
+
+	r, ok := c.lookup(p, metadata)
+	if !ok || r.id != "abc" || !r.cached || r.path != p || len(r.findings) != 1 {
+		t.Fatalf("expected a cache hit, got %v %+v", ok, r)
+	}
+	if _, ok := c.lookup(p, nil); ok {
+		t.Error("expected a miss with different metadata")
+	}
+	if _, ok := newResultCache(c.path, "other:4000", time.Hour).lookup(p, metadata); ok {
+		t.Error("expected a miss for another endpoint")
+	}
+
+	// same size and modification time but different content
+	if err := os.WriteFile(p, []byte("SAMPLE CONTENT"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := os.Chtimes(p, info.ModTime(), info.ModTime()); err != nil {
+		t.Fatalf("chtimes: %s", err)
+	}
+	if _, ok := c.lookup(p, metadata); ok {
+		t.Error("expected a miss for changed content")
+	}
+	if c.hits.Load() != 1 {
+		t.Errorf("want 1 hit, got %d", c.hits.Load())
+	}
+}
+
+func TestResultCacheExpiry(t *testing.T) {
+	p, info, sum := cacheSample(t)
+	c := newResultCache(filepath.Join(t.TempDir(), cacheFileName), "localhost:4000", time.Hour)
+	c.store(p, info, sum, nil, &resultRecord{id: "abc"})
+
+	abs, _ := filepath.Abs(p)
+	entry := c.entries[c.endpoint][abs]
+	entry.Stored = time.Now().Add(-2 * time.Hour)
+	c.entries[c.endpoint][abs] = entry
+
+	if _, ok := c.lookup(p, nil); ok {
+		t.Error("expected an expired entry to miss")
+	}
+	if err := c.save(); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+	if len(c.entries) != 0 {
+		t.Errorf("expected expired entries to be dropped, got %v", c.entries)
+	}
+}
+
+func TestResultCacheSaveAndLoad(t *testing.T) {
+	p, info, sum := cacheSample(t)
+	path := filepath.Join(t.TempDir(), "nested", cacheFileName)
+	c := newResultCache(path, "localhost:4000", time.Hour)
+	c.store(p, info, sum, nil, &resultRecord{id: "abc", checksum: sum})
+	if err := c.save(); err != nil {
+		t.Fatalf("save: %s", err)
+	}
+
+	loaded, err := loadResultCache(path, "localhost:4000", time.Hour)
+	if err != nil {
+		t.Fatalf("load: %s", err)
+	}
+	if r, ok := loaded.lookup(p, nil); !ok || r.id != "abc" {
+		t.Errorf("expected the saved entry to hit, got %v %+v", ok, r)
+	}
+
+	if err := os.WriteFile(path, []byte("{"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if _, err := loadResultCache(path, "localhost:4000", time.Hour); err == nil {
+		t.Error("expected an error for a damaged cache")
+	}
+	if _, err := loadResultCache(filepath.Join(t.TempDir(), "missing.json"), "localhost:4000", time.Hour); err != nil {
+		t.Errorf("expected a missing cache to be empty, got %s", err)
+	}
+}
+
+func TestServiceProcessUsesCache(t *testing.T) {
+	svc := newTestService(t)
+	svc.cache = newResultCache(filepath.Join(t.TempDir(), cacheFileName), ts.Endpoint, time.Hour)
+
+	run := func() resultRecord {
+		stream := make(chan string, 1)
+		stream <- fakeMalwareSample
+		close(stream)
+
+		var result resultRecord
+		if err := svc.process(context.Background(), stream, 1, "", false, nil, func(r resultRecord) { result = r }); err != nil {
+			t.Fatalf("process failed: %s", err)
+		}
+		return result
+	}
+
+	first := run()
+	if first.err != nil || first.cached {
+		t.Fatalf("expected an upload, got %+v", first)
+	}
+	second := run()
+	if !second.cached || second.id != first.id {
+		t.Fatalf("expected the second run to hit the cache, got %+v", second)
+	}
+	checkResponseContent(t, &second)
+}
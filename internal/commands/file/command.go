@@ -6,9 +6,15 @@ import (
 	"github.com/spf13/cobra"
 )
 
+// HandlesSignalsAnnotation marks commands that stop cleanly once their
+// context is cancelled by SIGINT or SIGTERM, the root command does not exit
+// on the signal before they return.
+const HandlesSignalsAnnotation = "sc/handles-signals"
+
 // Command returns the files cobra command with all subcommands.
 func Command(ctx context.Context, profile *string) *cobra.Command {
-	var metadata string
+	var metadata metadataFlags
+	var output string
 
 	parent := cobra.Command{
 		Use:   "files",
@@ -16,13 +22,17 @@ func Command(ctx context.Context, profile *string) *cobra.Command {
 		Long:  `Files API operations. Detailed API documentation can be found here: https://uvasoftware.github.io/openapi/v22/#/Files`,
 	}
 
-	parent.PersistentFlags().StringVarP(&metadata, "metadata", "m", "", "Metadata in the format key=value,key2=value2 to be associated with the request")
+	parent.PersistentFlags().StringArrayVarP(&metadata.pairs, "metadata", "m", nil, "Metadata in the format key=value to be associated with the request, repeatable or comma separated with quoted values holding commas; values may use templates such as {{.Path}} expanded per local file, not supported by fetch")
+	parent.PersistentFlags().StringVar(&metadata.file, "metadata-file", "", "JSON or YAML file with an object of metadata to be associated with the request, --metadata takes precedence")
+
+	parent.PersistentFlags().StringVarP(&output, "output", "o", string(outputText), "Output format, one of text, json, ndjson or csv")
 
-	parent.AddCommand(processCommand(ctx, profile, &metadata))
-	parent.AddCommand(asyncCommand(ctx, profile, &metadata))
-	parent.AddCommand(fetchCommand(ctx, profile, &metadata))
-	parent.AddCommand(retrieveCommand(ctx, profile))
-	parent.AddCommand(traceCommand(ctx, profile))
+	parent.AddCommand(processCommand(ctx, profile, &metadata, &output))
+	parent.AddCommand(asyncCommand(ctx, profile, &metadata, &output))
+	parent.AddCommand(watchCommand(ctx, profile, &metadata, &output))
+	parent.AddCommand(fetchCommand(ctx, profile, &metadata, &output))
+	parent.AddCommand(retrieveCommand(ctx, profile, &output))
+	parent.AddCommand(traceCommand(ctx, profile, &output))
 
 	return &parent
 }
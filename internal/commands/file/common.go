@@ -2,8 +2,8 @@ package file
 
 import (
 	"fmt"
-	"log/slog"
 	"strings"
+	"time"
 
 	"github.com/uvasoftware/scanii-cli/internal/terminal"
 )
@@ -19,23 +19,29 @@ type resultRecord struct {
 	contentLength uint64
 	creationDate  string
 	metadata      map[string]string
+	// elapsed is how long the upload took, zero for results not produced by service.process
+	elapsed time.Duration
+	// cached is set when the result came from the local result cache instead of an upload
+	cached bool
+	// retries is how many times the upload was retried after the first attempt
+	retries int
+	// streamed is set for content read from standard input or a named pipe,
+	// path is then only a display name and not a file on disk
+	streamed bool
+	// staged is set for content read from the git index, the file at path
+	// may have changed since and is not what was scanned
+	staged bool
 }
 
-// extractMetadata parses the metadata string and returns a map of key/value pairs.
-func extractMetadata(metadata string) map[string]string {
-	result := make(map[string]string)
-	if metadata == "" {
-		return result
+// withMetadata returns a copy of metadata with key set, unless the user
+// already set it.
+func withMetadata(metadata map[string]string, key, value string) map[string]string {
+	if _, ok := metadata[key]; ok {
+		return metadata
 	}
-
-	parts := strings.Split(metadata, ",")
-	for _, p := range parts {
-		kv := strings.Split(p, "=")
-		if len(kv) != 2 {
-			slog.Warn("invalid metadata entry", "entry", p)
-			continue
-		}
-		result[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	result := map[string]string{key: value}
+	for k, v := range metadata {
+		result[k] = v
 	}
 	return result
 }
@@ -52,6 +58,10 @@ func printFileResult(result *resultRecord) {
 
 	terminal.KeyValue("id:", result.id)
 
+	if result.cached {
+		terminal.KeyValue("cached:", "yes")
+	}
+
 	if result.checksum != "" {
 		terminal.KeyValue("checksum/sha1:", result.checksum)
 	}
@@ -0,0 +1,125 @@
+package file
+
+import (
+	"fmt"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+)
+
+// resultConsumer handles every result of a process, async or watch run: it
+// counts it, evaluates the policy, writes the output, acts on the file and
+// keeps it for the end of run reports.
+type resultConsumer struct {
+	out *output
+	// policy, remediation, journal and archives are only set when enabled
+	policy      *policy
+	remediation *remediation
+	journal     *journal
+	archives    *expander
+	// collect keeps every result for the SARIF and JUnit reports
+	collect bool
+	// progress, when set, is shown in place of each result in text mode
+	progress func()
+
+	finished     atomic.Uint64
+	failed       atomic.Uint64
+	withFindings atomic.Uint64
+	resumed      atomic.Uint64
+	retried      atomic.Uint64
+	retries      atomic.Uint64
+
+	mu      sync.Mutex
+	records []resultRecord
+}
+
+// newResultConsumer returns a consumer writing to out and acting as opts ask.
+func newResultConsumer(out *output, opts processOptions) *resultConsumer {
+	return &resultConsumer{out: out, policy: opts.policy, remediation: opts.remediation, collect: opts.collect()}
+}
+
+// consume counts, evaluates and writes a result.
+func (c *resultConsumer) consume(r resultRecord) {
+	if r.err != nil {
+		slog.Error("failed to process file", "file", r.path, "error", r.err)
+		c.failed.Add(1)
+	} else {
+		c.finished.Add(1)
+	}
+	if r.retries > 0 {
+		c.retried.Add(1)
+		c.retries.Add(uint64(r.retries)) //nolint:gosec
+	}
+	if len(r.findings) > 0 {
+		c.withFindings.Add(1)
+	}
+	if c.policy != nil {
+		c.policy.evaluate(&r)
+	}
+	if c.collect {
+		c.mu.Lock()
+		c.records = append(c.records, r)
+		c.mu.Unlock()
+	}
+
+	if c.progress == nil || c.out.machine() {
+		if err := c.out.result(&r); err != nil {
+			slog.Error("failed to write result", "file", r.path, "error", err)
+		}
+	}
+	if c.progress != nil {
+		c.progress()
+	}
+}
+
+// finish consumes a result and then acts on its file.
+func (c *resultConsumer) finish(r resultRecord) {
+	c.consume(r)
+	if c.remediation != nil {
+		c.remediation.apply(&r)
+	}
+	if c.archives != nil {
+		c.archives.release(r.path)
+	}
+}
+
+// replay finishes a result read back from a journal, so reports, the summary
+// and remediation match an uninterrupted run.
+func (c *resultConsumer) replay(r resultRecord) {
+	c.resumed.Add(1)
+	c.finish(r)
+}
+
+// journaled records a freshly uploaded result in the journal.
+func (c *resultConsumer) journaled(r *resultRecord) {
+	if c.journal == nil {
+		return
+	}
+	if err := c.journal.record(r); err != nil {
+		slog.Error("failed to write journal entry", "file", r.path, "error", err)
+	}
+}
+
+// printSummary prints the totals under headline followed by notes, then the
+// remediation and policy reports, returning the policy's verdict.
+func (c *resultConsumer) printSummary(headline string, notes ...string) error {
+	terminal.Newline()
+	terminal.Success(headline)
+	terminal.Success(fmt.Sprintf("Files with findings: %d, unable to process: %d and successfully processed: %d", c.withFindings.Load(), c.failed.Load(), c.finished.Load()))
+	for _, n := range notes {
+		terminal.Info(n)
+	}
+	if n := c.retries.Load(); n > 0 {
+		terminal.Info(fmt.Sprintf("Retries: %d across %d file(s)", n, c.retried.Load()))
+	}
+	if c.remediation != nil {
+		c.remediation.report()
+	}
+	if c.policy != nil {
+		c.policy.report()
+		return c.policy.verdict()
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package file
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestResultConsumer(t *testing.T) {
+	var buf bytes.Buffer
+	c := newResultConsumer(newOutput(outputNDJSON, &buf), processOptions{
+		policy: newTestPolicy([]string{"content.malicious.*"}, nil, true),
+		junit:  "report.xml",
+	})
+
+	c.finish(resultRecord{path: "a", findings: []string{"content.malicious.eicar-test-signature"}, retries: 2})
+	c.finish(resultRecord{path: "b", err: errors.New("boom")})
+	c.replay(resultRecord{path: "c"})
+
+	if got := c.finished.Load(); got != 2 {
+		t.Errorf("want 2 finished, got %d", got)
+	}
+	if got := c.failed.Load(); got != 1 {
+		t.Errorf("want 1 failed, got %d", got)
+	}
+	if c.withFindings.Load() != 1 || c.resumed.Load() != 1 || c.retried.Load() != 1 || c.retries.Load() != 2 {
+		t.Errorf("unexpected counters, findings %d, resumed %d, retried %d, retries %d", c.withFindings.Load(), c.resumed.Load(), c.retried.Load(), c.retries.Load())
+	}
+	if len(c.records) != 3 {
+		t.Errorf("want 3 records kept for reports, got %d", len(c.records))
+	}
+	if lines := strings.Split(strings.TrimSpace(buf.String()), "\n"); len(lines) != 3 {
+		t.Errorf("want 3 results written, got %d", len(lines))
+	}
+	if got := exitCode(t, c.printSummary("done")); got != defaultExitBoth {
+		t.Errorf("want exit code %d, got %d", defaultExitBoth, got)
+	}
+}
@@ -1,32 +1,62 @@
 package file
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"log/slog"
 	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/uvasoftware/scanii-cli/internal/client"
 	"github.com/uvasoftware/scanii-cli/internal/commands/profile"
 	"github.com/uvasoftware/scanii-cli/internal/terminal"
+	"golang.org/x/sync/errgroup"
 )
 
-func fetchCommand(ctx context.Context, profileName, metadata *string) *cobra.Command {
+// defaultFetchConcurrency is how many URLs are submitted at once.
+const defaultFetchConcurrency = 8
+
+func fetchCommand(ctx context.Context, profileName *string, metadata *metadataFlags, outputFormat *string) *cobra.Command {
 	var callback string
 	var wait int
+	var fromFile string
+	concurrency := defaultFetchConcurrency
 
 	cmd := &cobra.Command{
-		Use:        "fetch [flags] [url]",
-		Short:      "Submit a URL for asynchronous processing",
-		Args:       cobra.ExactArgs(1),
-		ArgAliases: []string{"file/directory"},
+		Use:   "fetch [flags] [url]",
+		Short: "Submit a URL for asynchronous processing",
+		// a summary of the URLs submitted is printed once interrupted
+		Annotations: map[string]string{HandlesSignalsAnnotation: "true"},
+		Args:        cobra.MaximumNArgs(1),
+		ArgAliases:  []string{"url"},
+		Long: `Submit a URL for asynchronous processing. With --from-file, every URL listed in
+the file, one per line, is submitted instead; use - to read the list from standard input.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
+			if (len(args) == 1) == (fromFile != "") {
+				return errors.New("either a url or --from-file is required")
+			}
+			out, err := openOutput(*outputFormat)
+			if err != nil {
+				return err
+			}
+			md, err := metadata.parse()
+			if err != nil {
+				return err
+			}
+			if md, err = staticMetadata(md, "fetch"); err != nil {
+				return err
+			}
+
 			config, err := profile.Load(*profileName)
 			if err != nil {
 				return err
@@ -38,28 +68,180 @@ func fetchCommand(ctx context.Context, profileName, metadata *string) *cobra.Com
 				return err
 			}
 
-			result, err := callFilesFetch(ctx, c, args[0], callback, *metadata)
+			if fromFile != "" {
+				urls, err := readURLs(fromFile)
+				if err != nil {
+					return err
+				}
+				return fetchAll(ctx, c, urls, fetchOptions{
+					callback:    callback,
+					metadata:    md,
+					concurrency: concurrency,
+					wait:        time.Duration(wait) * time.Second,
+					output:      out,
+				})
+			}
+
+			startTime := time.Now()
+			result, err := callFilesFetch(ctx, c, args[0], callback, md)
 			if err != nil {
 				return err
 			}
+			terminal.Success(fmt.Sprintf("Request accepted with id %s in %s", result.id, terminal.FormatDuration(time.Since(startTime))))
+			terminal.KeyValue("id:", result.id)
+			if callback != "" {
+				terminal.KeyValue("callback:", callback)
+			}
+			terminal.KeyValue("location:", result.location)
+			terminal.Newline()
+			terminal.Info(fmt.Sprintf("Retrieve the result with: sc files retrieve %s", result.id))
 
 			if wait > 0 {
-				_, err = callFileRetrieve(ctx, c, result.id, wait)
-				return err
+				result, err = callFileRetrieve(ctx, c, result.id, wait)
+				if err != nil {
+					return err
+				}
+				if err := out.result(result); err != nil {
+					return err
+				}
+			} else if out.machine() {
+				if err := out.result(result); err != nil {
+					return err
+				}
 			}
-			return nil
+			return out.close()
 		},
 	}
 
 	cmd.PersistentFlags().StringVar(&callback, "callback", "", "Callback URL to be invoked when processing is complete")
 	cmd.PersistentFlags().IntVarP(&wait, "wait", "w", 0, "Seconds to poll for the result before giving up")
+	cmd.PersistentFlags().StringVarP(&fromFile, "from-file", "f", "", "Submit every URL listed in this file, one per line, - reads the list from standard input")
+	cmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", concurrency, "Number of URLs submitted concurrently with --from-file")
 
 	return cmd
 }
 
-// callFilesFetch processes a remote url.
-func callFilesFetch(ctx context.Context, c *client.Client, location, callback, metadata string) (*resultRecord, error) {
+// readURLs reads a list of URLs, one per line, skipping blank lines and
+// lines starting with #.
+func readURLs(name string) ([]string, error) {
+	var r io.Reader = os.Stdin
+	if name != stdinPath {
+		fd, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open url list: %w", err)
+		}
+		defer func() { _ = fd.Close() }()
+		r = fd
+	}
+
+	var urls []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		urls = append(urls, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read url list: %w", err)
+	}
+	return urls, nil
+}
+
+// fetchOptions holds the settings of a batch fetch.
+type fetchOptions struct {
+	callback    string
+	metadata    map[string]string
+	concurrency int
+	// wait, when positive, is how long each URL's result is polled for
+	wait   time.Duration
+	output *output
+}
+
+// fetchAll submits every URL, at most concurrency at a time, and reports an
+// outcome for each. Results are keyed by URL, which is also sent as url metadata.
+// An error is returned when any URL failed.
+func fetchAll(ctx context.Context, c *client.Client, urls []string, opts fetchOptions) error {
+	out := opts.output
+	if out == nil {
+		out = newOutput(outputText, os.Stdout)
+	}
+	terminal.Info(fmt.Sprintf("Submitting %s URL(s)", terminal.FormatNumber(int64(len(urls)))))
+
+	// counters
+	urlsFinished := atomic.Uint64{}
+	urlsFailed := atomic.Uint64{}
+	urlsWithFindings := atomic.Uint64{}
+
+	consume := func(result resultRecord) {
+		if result.err != nil {
+			slog.Error("failed to fetch url", "url", result.path, "error", result.err)
+			urlsFailed.Add(1)
+		} else {
+			urlsFinished.Add(1)
+		}
+		if len(result.findings) > 0 {
+			urlsWithFindings.Add(1)
+		}
+		if err := out.result(&result); err != nil {
+			slog.Error("failed to write result", "url", result.path, "error", err)
+		}
+	}
+
+	var results *poller
+	if opts.wait > 0 {
+		results = newPoller(&service{client: c}, retryPolicy{delay: defaultPollInterval, maxDelay: defaultPollMaxDelay}, opts.wait, opts.concurrency)
+	}
+
 	startTime := time.Now()
+	g := errgroup.Group{}
+	g.SetLimit(max(opts.concurrency, 1))
+	for _, location := range urls {
+		g.Go(func() error {
+			started := time.Now()
+			r := resultRecord{path: location}
+			submitted, err := callFilesFetch(ctx, c, location, opts.callback, withMetadata(opts.metadata, "url", location))
+			if err != nil {
+				r.err = err
+				consume(r)
+				return nil
+			}
+			r.id = submitted.id
+			r.location = submitted.location
+			r.elapsed = time.Since(started)
+			if results != nil {
+				results.wait(ctx, r, consume)
+				return nil
+			}
+			consume(r)
+			return nil
+		})
+	}
+	_ = g.Wait()
+	if results != nil {
+		results.close()
+	}
+	if err := out.close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	terminal.Newline()
+	if results != nil {
+		terminal.Success(fmt.Sprintf("Completed in %s, %s URL(s) analyzed", terminal.FormatDuration(time.Since(startTime)), terminal.FormatNumber(int64(urlsFinished.Load())))) //nolint:gosec
+		terminal.Success(fmt.Sprintf("URLs with findings: %d, unable to process: %d and successfully processed: %d", urlsWithFindings.Load(), urlsFailed.Load(), urlsFinished.Load()))
+	} else {
+		terminal.Success(fmt.Sprintf("Completed in %s, %s URL(s) accepted and %d rejected", terminal.FormatDuration(time.Since(startTime)), terminal.FormatNumber(int64(urlsFinished.Load())), urlsFailed.Load())) //nolint:gosec
+	}
+	// scripts see a partial failure without parsing the output
+	if n := urlsFailed.Load(); n > 0 {
+		return fmt.Errorf("%d of %d URL(s) failed", n, len(urls))
+	}
+	return nil
+}
+
+// callFilesFetch submits a remote url for processing.
+func callFilesFetch(ctx context.Context, c *client.Client, location, callback string, metadata map[string]string) (*resultRecord, error) {
 	slog.Debug("processing location", "url", location)
 
 	// verifying url
@@ -67,11 +249,9 @@ func callFilesFetch(ctx context.Context, c *client.Client, location, callback, m
 		return nil, fmt.Errorf("unable to parse url: %w", err)
 	}
 
-	m := extractMetadata(metadata)
-
 	// because of how we pass metadata arguments, we must manually encode the payload
 	form := url.Values{}
-	for k, v := range m {
+	for k, v := range metadata {
 		form.Add(fmt.Sprintf("metadata[%s]", k), v)
 	}
 	form.Add("location", location)
@@ -93,23 +273,13 @@ func callFilesFetch(ctx context.Context, c *client.Client, location, callback, m
 		return nil, fmt.Errorf("error: unexpected status code %d", result.StatusCode)
 	}
 
-	id := *result.Pending.ID
-	terminal.Success(fmt.Sprintf("Request accepted with id %s in %s", id, terminal.FormatDuration(time.Since(startTime))))
-	terminal.KeyValue("id:", id)
-	if callback != "" {
-		terminal.KeyValue("callback:", callback)
-	}
-	terminal.KeyValue("location:", result.Header.Get("Location"))
-	fmt.Println()
-	terminal.Info(fmt.Sprintf("Retrieve the result with: sc files retrieve %s", id))
-
 	return &resultRecord{
-		id:       id,
+		id:       *result.Pending.ID,
 		location: result.Header.Get("Location"),
 	}, nil
 }
 
-func runLocationProcess(ctx context.Context, c *client.Client, location, callback, metadata string) (*resultRecord, error) {
+func runLocationProcess(ctx context.Context, c *client.Client, location, callback string, metadata map[string]string) (*resultRecord, error) {
 	slog.Debug("processing location", "url", location)
 
 	// verifying url
@@ -117,8 +287,6 @@ func runLocationProcess(ctx context.Context, c *client.Client, location, callbac
 		return nil, fmt.Errorf("unable to parse url: %w", err)
 	}
 
-	m := extractMetadata(metadata)
-
 	// because of how we pass metadata arguments, we must manually encode the payload
 	body := bytes.Buffer{}
 	mp := multipart.NewWriter(&body)
@@ -128,7 +296,7 @@ func runLocationProcess(ctx context.Context, c *client.Client, location, callbac
 		return nil, err
 	}
 
-	for k, v := range m {
+	for k, v := range metadata {
 		err = mp.WriteField(fmt.Sprintf("metadata[%s]", k), v)
 		if err != nil {
 			return nil, err
@@ -180,6 +348,5 @@ func runLocationProcess(ctx context.Context, c *client.Client, location, callbac
 		r.metadata = *pr.Metadata
 	}
 
-	printFileResult(&r)
 	return &r, nil
 }
@@ -1,9 +1,17 @@
 package file
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 	"testing"
+	"time"
 )
 
 // checkResponseContent checks that the result is the expected sample test file
@@ -33,7 +41,7 @@ func TestShouldProcessLocationSync(t *testing.T) {
 		t.Fatalf("failed to create client: %s", err)
 	}
 
-	result, err := runLocationProcess(context.Background(), client, fmt.Sprintf("http://%s/static/eicar.txt", ts.Endpoint), "", "m1=v1")
+	result, err := runLocationProcess(context.Background(), client, fmt.Sprintf("http://%s/static/eicar.txt", ts.Endpoint), "", map[string]string{"m1": "v1"})
 	if err != nil {
 		t.Fatalf("failed to process file: %s", err)
 	}
@@ -54,7 +62,7 @@ func TestShouldProcessFetch(t *testing.T) {
 	}
 
 	t.Run("positive", func(t *testing.T) {
-		result, err := callFilesFetch(context.Background(), client, fmt.Sprintf("http://%s/static/eicar.txt", ts.Endpoint), "", "m1=v1")
+		result, err := callFilesFetch(context.Background(), client, fmt.Sprintf("http://%s/static/eicar.txt", ts.Endpoint), "", map[string]string{"m1": "v1"})
 		if err != nil {
 			t.Fatalf("failed to process file: %s", err)
 		}
@@ -78,7 +86,7 @@ func TestShouldProcessFetch(t *testing.T) {
 	})
 
 	t.Run("negative", func(t *testing.T) {
-		result, err := callFilesFetch(context.Background(), client, fmt.Sprintf("http://%s/static/nope", ts.Endpoint), "", "m1=v1")
+		result, err := callFilesFetch(context.Background(), client, fmt.Sprintf("http://%s/static/nope", ts.Endpoint), "", map[string]string{"m1": "v1"})
 		if err != nil {
 			t.Fatalf("failed to process file: %s", err)
 		}
@@ -114,45 +122,87 @@ func TestCallFileRetrieveEmptyID(t *testing.T) {
 	}
 }
 
-func TestExtractMetadata(t *testing.T) {
-	t.Run("empty", func(t *testing.T) {
-		m := extractMetadata("")
-		if len(m) != 0 {
-			t.Fatalf("expected empty map, got %v", m)
-		}
-	})
-
-	t.Run("single", func(t *testing.T) {
-		m := extractMetadata("k1=v1")
-		if m["k1"] != "v1" {
-			t.Fatalf("expected k1=v1, got %v", m)
-		}
-	})
+func TestReadURLs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "urls.txt")
+	if err := os.WriteFile(path, []byte("# assets\nhttps://a.example/1\n\n  https://b.example/2  \r\n"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	urls, err := readURLs(path)
+	if err != nil {
+		t.Fatalf("readURLs: %s", err)
+	}
+	if !slices.Equal(urls, []string{"https://a.example/1", "https://b.example/2"}) {
+		t.Fatalf("unexpected urls %v", urls)
+	}
+}
 
-	t.Run("multiple", func(t *testing.T) {
-		m := extractMetadata("k1=v1,k2=v2")
-		if m["k1"] != "v1" {
-			t.Fatalf("expected k1=v1, got %v", m)
-		}
-		if m["k2"] != "v2" {
-			t.Fatalf("expected k2=v2, got %v", m)
-		}
-	})
+func TestFetchAll(t *testing.T) {
+	client, err := ts.Profile.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %s", err)
+	}
+	urls := []string{
+		fmt.Sprintf("http://%s/static/eicar.txt", ts.Endpoint),
+		fmt.Sprintf("http://%s/static/nope", ts.Endpoint),
+		"http://[::1",
+	}
 
-	t.Run("whitespace", func(t *testing.T) {
-		m := extractMetadata(" k1 = v1 , k2 = v2 ")
-		if m["k1"] != "v1" {
-			t.Fatalf("expected k1=v1, got %v", m)
-		}
-		if m["k2"] != "v2" {
-			t.Fatalf("expected k2=v2, got %v", m)
-		}
-	})
+	for _, wait := range []bool{false, true} {
+		t.Run(fmt.Sprintf("wait=%v", wait), func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			opts := fetchOptions{metadata: map[string]string{"m1": "v1"}, concurrency: 2, output: newOutput(outputNDJSON, buf)}
+			if wait {
+				opts.wait = time.Minute
+			}
+			// the invalid url fails, and the missing one once waited for
+			failed := 1
+			if wait {
+				failed = 2
+			}
+			err := fetchAll(context.Background(), client, urls, opts)
+			if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("%d of 3", failed)) {
+				t.Fatalf("expected %d failure(s) to fail the command, got %v", failed, err)
+			}
+
+			results := map[string]resultOutput{}
+			scanner := bufio.NewScanner(buf)
+			for scanner.Scan() {
+				var r resultOutput
+				if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+					t.Fatalf("unmarshal: %s", err)
+				}
+				results[r.Path] = r
+			}
+			if len(results) != len(urls) {
+				t.Fatalf("expected an outcome per url, got %v", results)
+			}
+			if results[urls[2]].Error == "" {
+				t.Errorf("expected the invalid url to fail, got %+v", results[urls[2]])
+			}
+			eicar := results[urls[0]]
+			if eicar.ID == "" {
+				t.Fatalf("expected an id, got %+v", eicar)
+			}
+			if !wait {
+				return
+			}
+			if len(eicar.Findings) == 0 || eicar.Metadata["url"] != urls[0] || eicar.Metadata["m1"] != "v1" {
+				t.Errorf("expected findings and url metadata, got %+v", eicar)
+			}
+			if results[urls[1]].Error == "" {
+				t.Errorf("expected the missing url to fail, got %+v", results[urls[1]])
+			}
+		})
+	}
+}
 
-	t.Run("invalid_entry_skipped", func(t *testing.T) {
-		m := extractMetadata("k1=v1,invalid,k2=v2")
-		if len(m) != 2 {
-			t.Fatalf("expected 2 entries, got %d", len(m))
+func TestCommandsHandlingSignals(t *testing.T) {
+	profile := "default"
+	handling := map[string]bool{"process": true, "async": true, "fetch": true, "watch": true}
+	for _, cmd := range Command(context.Background(), &profile).Commands() {
+		_, handles := cmd.Annotations[HandlesSignalsAnnotation]
+		if handles != handling[cmd.Name()] {
+			t.Errorf("unexpected signal handling for %s: %v", cmd.Name(), handles)
 		}
-	})
+	}
 }
@@ -0,0 +1,145 @@
+package file
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/uvasoftware/scanii-cli/internal/vcs"
+)
+
+// gitSelection picks the files to process from a git repository instead of
+// walking every file in a directory, the selected sets are combined.
+type gitSelection struct {
+	// staged selects files added or modified in the index
+	staged bool
+	// diff selects files changed between revisions, as in main...HEAD
+	diff string
+	// untracked selects files git neither tracks nor ignores
+	untracked bool
+}
+
+func addGitFlags(cmd *cobra.Command, g *gitSelection) {
+	cmd.PersistentFlags().BoolVar(&g.staged, "git-staged", false, "Only process files staged in the git index, as in a pre-commit hook, uploading their staged content")
+	cmd.PersistentFlags().StringVar(&g.diff, "git-diff", "", "Only process files changed between git revisions, as in main...HEAD; a single revision is compared to the working tree")
+	cmd.PersistentFlags().BoolVar(&g.untracked, "git-untracked", false, "Only process files not tracked by git, ignored files excepted")
+}
+
+func (g gitSelection) enabled() bool {
+	return g.staged || g.diff != "" || g.untracked
+}
+
+// files lists the selected files relative to dir, sorted and without
+// duplicates. The list is never nil so an empty selection walks nothing.
+func (g gitSelection) files(dir string) ([]string, error) {
+	if info, err := os.Stat(dir); err != nil || !info.IsDir() {
+		return nil, errors.New("--git-staged, --git-diff and --git-untracked require a directory inside a git repository")
+	}
+
+	result := []string{}
+	add := func(files []string, err error) error {
+		result = append(result, files...)
+		return err
+	}
+	if g.staged {
+		if err := add(vcs.Staged(dir)); err != nil {
+			return nil, err
+		}
+	}
+	if g.diff != "" {
+		if err := add(vcs.Changed(dir, g.diff)); err != nil {
+			return nil, err
+		}
+	}
+	if g.untracked {
+		if err := add(vcs.Untracked(dir)); err != nil {
+			return nil, err
+		}
+	}
+	slices.Sort(result)
+	return slices.Compact(result), nil
+}
+
+// gitIndex holds the files whose staged content is uploaded instead of the
+// working tree copy, so a pre-commit hook scans what is being committed.
+type gitIndex struct {
+	dir string
+	// paths maps each walked path to the slash separated path git knows it by
+	paths map[string]string
+}
+
+// index returns the staged files of dir, nil unless --git-staged is set.
+func (g gitSelection) index(dir string) (*gitIndex, error) {
+	if !g.staged {
+		return nil, nil
+	}
+	staged, err := vcs.Staged(dir)
+	if err != nil {
+		return nil, err
+	}
+	i := &gitIndex{dir: dir, paths: make(map[string]string, len(staged))}
+	for _, rel := range staged {
+		i.paths[filepath.Join(dir, filepath.FromSlash(rel))] = rel
+	}
+	return i, nil
+}
+
+// lookup reports whether path is uploaded from the index.
+func (i *gitIndex) lookup(path string) bool {
+	if i == nil {
+		return false
+	}
+	_, ok := i.paths[path]
+	return ok
+}
+
+// open streams the staged content of path.
+func (i *gitIndex) open(path string) (io.ReadCloser, error) {
+	return vcs.Blob(i.dir, i.paths[path])
+}
+
+// size returns the size of the staged content of path.
+func (i *gitIndex) size(path string) (int64, error) {
+	return vcs.BlobSize(i.dir, i.paths[path])
+}
+
+// stat describes the staged content of path as a regular file.
+func (i *gitIndex) stat(path string) (os.FileInfo, error) {
+	size, err := i.size(path)
+	if err != nil {
+		return nil, err
+	}
+	return stagedInfo{name: filepath.Base(path), size: size}, nil
+}
+
+// stagedInfo describes content in the index, which has no modification time.
+type stagedInfo struct {
+	name string
+	size int64
+}
+
+func (i stagedInfo) Name() string       { return i.name }
+func (i stagedInfo) Size() int64        { return i.size }
+func (i stagedInfo) Mode() os.FileMode  { return 0o644 }
+func (i stagedInfo) ModTime() time.Time { return time.Time{} }
+func (i stagedInfo) IsDir() bool        { return false }
+func (i stagedInfo) Sys() any           { return nil }
+
+// gitMetadata adds the commit and branch checked out in dir to metadata,
+// unless already set. A repository without commits has neither.
+func gitMetadata(dir string, metadata map[string]string) map[string]string {
+	if commit, err := vcs.Commit(dir); err == nil {
+		metadata = withMetadata(metadata, "git_commit", commit)
+	} else {
+		slog.Debug("no git commit to attach", "error", err)
+	}
+	if branch, err := vcs.Branch(dir); err == nil && branch != "" {
+		metadata = withMetadata(metadata, "git_branch", branch)
+	}
+	return metadata
+}
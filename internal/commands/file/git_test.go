@@ -0,0 +1,221 @@
+package file
+
+import (
+	"crypto/sha1" //nolint:gosec
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repository with a first commit holding files, each
+// given as a slash separated path, and returns a helper to run git in it.
+func gitRepo(t *testing.T, files ...string) (string, func(args ...string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	git("init", "-q", "-b", "main")
+	for _, f := range files {
+		writeTestFile(t, filepath.Join(root, filepath.FromSlash(f)))
+	}
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	return root, git
+}
+
+func TestGitSelection(t *testing.T) {
+	root, git := gitRepo(t, ".gitignore", "kept.txt", "changed.txt", "removed.txt", "sub/nested.txt")
+	if err := os.WriteFile(filepath.Join(root, ".gitignore"), []byte("*.log\n"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	git("commit", "-q", "-am", "ignore logs")
+	base := git("rev-parse", "HEAD")
+
+	// a committed change, a staged one and files git does not track
+	writeTestFile(t, filepath.Join(root, "sub", "committed.txt"))
+	git("add", ".")
+	git("rm", "-q", "removed.txt")
+	git("commit", "-q", "-m", "second")
+	if err := os.WriteFile(filepath.Join(root, "changed.txt"), []byte("changed"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	git("add", "changed.txt")
+	writeTestFile(t, filepath.Join(root, "sub", "untracked.txt"))
+	writeTestFile(t, filepath.Join(root, "debug.log"))
+
+	tests := []struct {
+		name string
+		dir  string
+		g    gitSelection
+		want []string
+	}{
+		{name: "staged", dir: root, g: gitSelection{staged: true}, want: []string{"changed.txt"}},
+		{name: "diff", dir: root, g: gitSelection{diff: base + "..HEAD"}, want: []string{"sub/committed.txt"}},
+		{name: "diff with working tree", dir: root, g: gitSelection{diff: base}, want: []string{"changed.txt", "sub/committed.txt"}},
+		{name: "untracked", dir: root, g: gitSelection{untracked: true}, want: []string{"sub/untracked.txt"}},
+		{name: "combined", dir: root, g: gitSelection{staged: true, diff: base, untracked: true}, want: []string{"changed.txt", "sub/committed.txt", "sub/untracked.txt"}},
+		{name: "subdirectory", dir: filepath.Join(root, "sub"), g: gitSelection{diff: base, untracked: true}, want: []string{"committed.txt", "untracked.txt"}},
+		{name: "nothing", dir: root, g: gitSelection{diff: "HEAD..HEAD"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.g.files(tt.dir)
+			if err != nil {
+				t.Fatalf("files: %s", err)
+			}
+			if got == nil || !slices.Equal(got, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+
+	for _, g := range []gitSelection{{diff: "doesnotexist..HEAD"}, {diff: "--output=x"}} {
+		if _, err := g.files(root); err == nil {
+			t.Errorf("expected %q to be rejected", g.diff)
+		}
+	}
+	if _, err := (gitSelection{staged: true}).files(t.TempDir()); err == nil {
+		t.Error("expected an error outside of a repository")
+	}
+
+	metadata := gitMetadata(root, map[string]string{"git_branch": "override"})
+	if metadata["git_commit"] != git("rev-parse", "HEAD") || metadata["git_branch"] != "override" {
+		t.Errorf("unexpected metadata %v", metadata)
+	}
+	git("checkout", "-q", "-b", "feature")
+	if metadata = gitMetadata(root, nil); metadata["git_branch"] != "feature" {
+		t.Errorf("expected the branch to be attached, got %v", metadata)
+	}
+	git("checkout", "-q", "--detach")
+	if metadata = gitMetadata(root, nil); metadata["git_branch"] != "" {
+		t.Errorf("expected no branch on a detached head, got %v", metadata)
+	}
+}
+
+func TestServiceUploadsStagedContent(t *testing.T) {
+	root, git := gitRepo(t, "file.txt", "other.txt")
+	contents, err := os.ReadFile(fakeMalwareSample)
+	if err != nil {
+		t.Fatalf("read sample: %s", err)
+	}
+	// the malware is staged, the working tree has been cleaned up since
+	path := filepath.Join(root, "file.txt")
+	if err := os.WriteFile(path, contents, 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	git("add", "file.txt")
+	if err := os.WriteFile(path, []byte("clean"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	svc := newTestService(t)
+	if svc.index, err = (gitSelection{staged: true}).index(root); err != nil {
+		t.Fatalf("index: %s", err)
+	}
+	if svc.index.lookup(filepath.Join(root, "other.txt")) {
+		t.Error("expected unstaged files to be read from the working tree")
+	}
+	r := processOne(t, svc, path)
+	if r.err != nil {
+		t.Fatalf("expected no error, got %s", r.err)
+	}
+	if want := fmt.Sprintf("%x", sha1.Sum(contents)); r.checksum != want || len(r.findings) == 0 { //nolint:gosec
+		t.Errorf("expected the staged content to be uploaded, got %s with %v", r.checksum, r.findings)
+	}
+
+	if index, err := (gitSelection{diff: "HEAD"}).index(root); err != nil || index != nil {
+		t.Errorf("expected no index without --git-staged, got %v %v", index, err)
+	}
+}
+
+func TestMetadataTemplatesStagedContent(t *testing.T) {
+	root, git := gitRepo(t, "file.txt")
+	path := filepath.Join(root, "file.txt")
+	staged := []byte("staged content")
+	if err := os.WriteFile(path, staged, 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	git("add", "file.txt")
+	if err := os.WriteFile(path, []byte("edited since staging"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	metadata := map[string]string{"size": "{{.Size}}", "sha256": "{{.SHA256}}", "mtime": "{{.ModTime}}"}
+	svc := newTestService(t)
+	var err error
+	if svc.templates, err = newMetadataTemplates(metadata, root); err != nil {
+		t.Fatalf("newMetadataTemplates: %s", err)
+	}
+	if svc.index, err = (gitSelection{staged: true}).index(root); err != nil {
+		t.Fatalf("index: %s", err)
+	}
+	expanded, err := svc.expandMetadata(path, metadata)
+	if err != nil {
+		t.Fatalf("expandMetadata: %s", err)
+	}
+	want := map[string]string{"size": fmt.Sprint(len(staged)), "sha256": fmt.Sprintf("%x", sha256.Sum256(staged)), "mtime": ""}
+	for k, v := range want {
+		if expanded[k] != v {
+			t.Errorf("expected %s of the staged content to be %q, got %q", k, v, expanded[k])
+		}
+	}
+}
+
+func TestWalkListsStagedContent(t *testing.T) {
+	root, git := gitRepo(t, "kept.txt", "removed.txt", "large.txt")
+	for name, content := range map[string]string{"kept.txt": "staged", "removed.txt": "staged", "large.txt": strings.Repeat("x", 100)} {
+		if err := os.WriteFile(filepath.Join(root, name), []byte(content), 0600); err != nil {
+			t.Fatalf("write: %s", err)
+		}
+	}
+	git("add", ".")
+	// the working tree moves on after staging
+	if err := os.WriteFile(filepath.Join(root, "kept.txt"), []byte(strings.Repeat("x", 100)), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := os.Remove(filepath.Join(root, "removed.txt")); err != nil {
+		t.Fatalf("remove: %s", err)
+	}
+
+	selection := gitSelection{staged: true}
+	opts := walkOptions{maxSize: 50}
+	var err error
+	if opts.files, err = selection.files(root); err != nil {
+		t.Fatalf("files: %s", err)
+	}
+	if opts.staged, err = selection.index(root); err != nil {
+		t.Fatalf("index: %s", err)
+	}
+	sizes := map[string]int64{}
+	err = fsWalker(root, opts, func(path string, d os.DirEntry) {
+		info, err := d.Info()
+		if err != nil {
+			t.Errorf("info: %s", err)
+			return
+		}
+		sizes[filepath.Base(path)] = info.Size()
+	})
+	if err != nil {
+		t.Fatalf("walk: %s", err)
+	}
+	want := map[string]int64{"kept.txt": 6, "removed.txt": 6}
+	if !maps.Equal(sizes, want) {
+		t.Errorf("expected staged files described by their staged content, got %v", sizes)
+	}
+}
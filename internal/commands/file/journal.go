@@ -0,0 +1,131 @@
+package file
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+)
+
+// journalEntry is one line of a journal, the result of a completed file.
+type journalEntry struct {
+	resultOutput
+	ElapsedMS int64 `json:"elapsed_ms,omitempty"`
+	// Staged keeps a replayed result of staged content from being acted on
+	Staged bool `json:"staged,omitempty"`
+}
+
+// journal appends every result of a run to a file as it completes so an
+// interrupted run can be resumed. Each line is written straight to disk,
+// so at most the line being written when the process stopped is lost. It is
+// safe for concurrent use.
+type journal struct {
+	mu sync.Mutex
+	fd *os.File
+}
+
+// openJournal creates the journal at path, or appends to it when resuming.
+func openJournal(path string, resume bool) (*journal, error) {
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	fd, err := os.OpenFile(path, flags, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if resume {
+		// terminate a line cut short by an interruption so new entries start clean
+		if err := terminateLastLine(path, fd); err != nil {
+			_ = fd.Close()
+			return nil, err
+		}
+	}
+	return &journal{fd: fd}, nil
+}
+
+func terminateLastLine(path string, w *os.File) error {
+	rd, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = rd.Close() }()
+
+	info, err := rd.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	last := make([]byte, 1)
+	if _, err := rd.ReadAt(last, info.Size()-1); err != nil {
+		return err
+	}
+	if last[0] != '\n' {
+		_, err = w.Write([]byte{'\n'})
+	}
+	return err
+}
+
+// record appends a result to the journal.
+func (j *journal) record(r *resultRecord) error {
+	data, err := json.Marshal(journalEntry{resultOutput: newResultOutput(r), ElapsedMS: r.elapsed.Milliseconds(), Staged: r.staged})
+	if err != nil {
+		return err
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	_, err = j.fd.Write(append(data, '\n'))
+	return err
+}
+
+func (j *journal) close() error {
+	return j.fd.Close()
+}
+
+// readJournal returns the files a previous run completed keyed by path.
+// Failed files are left out so they are tried again, and a later entry for
+// the same path replaces an earlier one. A missing journal is empty.
+func readJournal(path string) (map[string]resultRecord, error) {
+	completed := map[string]resultRecord{}
+
+	fd, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return completed, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = fd.Close() }()
+
+	scanner := bufio.NewScanner(fd)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var e journalEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// the last line is cut short when a run is killed mid write
+			slog.Warn("ignoring unreadable journal entry", "path", path, "line", line, "error", err)
+			continue
+		}
+		if e.Path == "" {
+			continue
+		}
+		if e.Error != "" {
+			delete(completed, e.Path)
+			continue
+		}
+		r := e.record()
+		r.elapsed = time.Duration(e.ElapsedMS) * time.Millisecond
+		r.staged = e.Staged
+		completed[e.Path] = r
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read journal %s: %w", path, err)
+	}
+	return completed, nil
+}
@@ -0,0 +1,163 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJournalRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.journal")
+	j, err := openJournal(path, false)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	records := []resultRecord{
+		{path: "a.txt", id: "1", findings: []string{"content.malicious.x"}, elapsed: 1500 * time.Millisecond, staged: true},
+		{path: "b.txt", err: errors.New("timeout")},
+		{path: "c.txt", err: errors.New("timeout")},
+		{path: "c.txt", id: "3"},
+		{path: "d.txt", id: "4"},
+		{path: "d.txt", err: errors.New("boom")},
+	}
+	for i := range records {
+		if err := j.record(&records[i]); err != nil {
+			t.Fatalf("record: %s", err)
+		}
+	}
+	if err := j.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	completed, err := readJournal(path)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if len(completed) != 2 {
+		t.Fatalf("expected a.txt and c.txt to be completed, got %v", completed)
+	}
+	a := completed["a.txt"]
+	if a.id != "1" || len(a.findings) != 1 || a.elapsed != 1500*time.Millisecond || !a.staged {
+		t.Errorf("unexpected replayed record %+v", a)
+	}
+	if completed["c.txt"].id != "3" {
+		t.Errorf("expected a later success to replace an earlier failure, got %+v", completed["c.txt"])
+	}
+}
+
+func TestJournalResumeAfterTruncatedLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "scan.journal")
+	if err := os.WriteFile(path, []byte(`{"path":"a.txt","id":"1","findings":[]}`+"\n"+`{"path":"b.t`), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	j, err := openJournal(path, true)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	if err := j.record(&resultRecord{path: "b.txt", id: "2"}); err != nil {
+		t.Fatalf("record: %s", err)
+	}
+	_ = j.close()
+
+	completed, err := readJournal(path)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if completed["a.txt"].id != "1" || completed["b.txt"].id != "2" {
+		t.Errorf("expected both entries to survive, got %v", completed)
+	}
+}
+
+func TestReadJournalMissing(t *testing.T) {
+	completed, err := readJournal(filepath.Join(t.TempDir(), "missing"))
+	if err != nil || len(completed) != 0 {
+		t.Errorf("expected an empty journal, got %v %s", completed, err)
+	}
+}
+
+func TestProcessResumeRemediatesReplayedResults(t *testing.T) {
+	useTestProfile(t)
+
+	// the interrupted run recorded a finding but never got to act on it
+	dir := t.TempDir()
+	path := filepath.Join(dir, "bad.exe")
+	writeTestFile(t, path)
+	journalPath := filepath.Join(t.TempDir(), "scan.journal")
+	j, err := openJournal(journalPath, false)
+	if err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	if err := j.record(&resultRecord{path: path, id: "1", findings: []string{malicious}}); err != nil {
+		t.Fatalf("record: %s", err)
+	}
+	if err := j.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	err = process(context.Background(), "test", dir, processOptions{
+		concurrency: 1,
+		journal:     journalPath,
+		resume:      true,
+		remediation: &remediation{action: actionDelete, on: []string{"content.malicious.*"}},
+		output:      newOutput(outputNDJSON, io.Discard),
+	})
+	if err != nil {
+		t.Fatalf("process: %s", err)
+	}
+	if exists(path) {
+		t.Error("expected the replayed result to be remediated")
+	}
+}
+
+func TestProcessInterruptedWritesJournal(t *testing.T) {
+	useTestProfile(t)
+	dir := t.TempDir()
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		writeTestFile(t, filepath.Join(dir, name))
+	}
+	journalPath := filepath.Join(t.TempDir(), "scan.journal")
+
+	// an interrupt cancels the context before anything is uploaded
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := process(ctx, "test", dir, processOptions{
+		concurrency: 1,
+		journal:     journalPath,
+		output:      newOutput(outputNDJSON, io.Discard),
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the run to report the interrupt, got %v", err)
+	}
+	if !exists(journalPath) {
+		t.Error("expected the journal to be written")
+	}
+	completed, err := readJournal(journalPath)
+	if err != nil || len(completed) != 0 {
+		t.Errorf("expected nothing to be completed, got %v %v", completed, err)
+	}
+}
+
+// useTestProfile points the home directory at a profile named test for the
+// test server, process loads its profile by name from there.
+func useTestProfile(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+	config, err := json.Marshal(ts.Profile)
+	if err != nil {
+		t.Fatalf("marshal profile: %s", err)
+	}
+	if err := os.MkdirAll(filepath.Join(home, ".config", "scanii-cli"), 0700); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".config", "scanii-cli", "test.json"), config, 0600); err != nil {
+		t.Fatalf("write profile: %s", err)
+	}
+}
@@ -0,0 +1,123 @@
+package file
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Name     string           `xml:"name,attr"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Errors   int              `xml:"errors,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	Errors    int             `xml:"errors,attr"`
+	Time      string          `xml:"time,attr"`
+	Timestamp string          `xml:"timestamp,attr"`
+	Cases     []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitProblem `xml:"failure,omitempty"`
+	Error     *junitProblem `xml:"error,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitProblem struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Body    string `xml:",chardata"`
+}
+
+func junitSeconds(d time.Duration) string {
+	return fmt.Sprintf("%.3f", d.Seconds())
+}
+
+// writeJUnit renders records as a JUnit XML report with one test case per
+// file, named by its path relative to root. Clean files pass, files with
+// findings fail listing them, and files that could not be uploaded error.
+func writeJUnit(w io.Writer, root string, records []resultRecord, started time.Time, elapsed time.Duration) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	sorted := make([]resultRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+
+	suite := junitTestSuite{
+		Name:      "scanii",
+		Tests:     len(sorted),
+		Time:      junitSeconds(elapsed),
+		Timestamp: started.UTC().Format("2006-01-02T15:04:05"),
+		Cases:     make([]junitTestCase, 0, len(sorted)),
+	}
+
+	for _, r := range sorted {
+		// plain paths, dashboards show names as they are
+		name := relativePath(absRoot, absPath(r.path))
+		tc := junitTestCase{
+			Name:      name,
+			ClassName: "scanii." + strings.ReplaceAll(path.Dir(name), "/", "."),
+			Time:      junitSeconds(r.elapsed),
+		}
+		if path.Dir(name) == "." {
+			tc.ClassName = "scanii"
+		}
+
+		switch {
+		case r.err != nil:
+			suite.Errors++
+			tc.Error = &junitProblem{Message: r.err.Error(), Type: "error", Body: r.err.Error()}
+		case len(r.findings) > 0:
+			suite.Failures++
+			tc.Failure = &junitProblem{
+				Message: fmt.Sprintf("findings: %s", strings.Join(r.findings, ", ")),
+				Type:    "finding",
+				Body:    strings.Join(r.findings, "\n"),
+			}
+		}
+		if r.id != "" {
+			tc.SystemOut = fmt.Sprintf("id: %s\nchecksum: %s", r.id, r.checksum)
+		}
+		suite.Cases = append(suite.Cases, tc)
+	}
+
+	report := junitTestSuites{
+		Name:     "sc files process",
+		Tests:    suite.Tests,
+		Failures: suite.Failures,
+		Errors:   suite.Errors,
+		Time:     suite.Time,
+		Suites:   []junitTestSuite{suite},
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		return err
+	}
+	_, err = io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,65 @@
+package file
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteJUnit(t *testing.T) {
+	root := t.TempDir()
+	records := []resultRecord{
+		{path: filepath.Join(root, "sub", "eicar.txt"), id: "a", findings: []string{"content.malicious.eicar-test-signature", "content.en.language.nsfw.0"}, elapsed: 1500 * time.Millisecond},
+		{path: filepath.Join(root, "my clean.txt"), id: "b", checksum: "55ca6286e3e4f4fba5d0448333fa99fc5a404a73"},
+		{path: filepath.Join(root, "locked.txt"), err: errors.New("permission denied")},
+	}
+
+	var buf bytes.Buffer
+	if err := writeJUnit(&buf, root, records, time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), 2*time.Second); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if !strings.HasPrefix(buf.String(), xml.Header) {
+		t.Error("expected an xml header")
+	}
+
+	var report junitTestSuites
+	if err := xml.Unmarshal(buf.Bytes(), &report); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if report.Tests != 3 || report.Failures != 1 || report.Errors != 1 || report.Time != "2.000" {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+
+	suite := report.Suites[0]
+	if suite.Timestamp != "2024-01-02T03:04:05" {
+		t.Errorf("unexpected timestamp %s", suite.Timestamp)
+	}
+
+	cases := map[string]junitTestCase{}
+	for _, tc := range suite.Cases {
+		cases[tc.Name] = tc
+	}
+
+	// names are plain paths, not escaped as in sarif
+	clean := cases["my clean.txt"]
+	if clean.Failure != nil || clean.Error != nil || clean.ClassName != "scanii" {
+		t.Errorf("expected my clean.txt to pass, got %+v", clean)
+	}
+
+	flagged := cases["sub/eicar.txt"]
+	if flagged.Failure == nil || !strings.Contains(flagged.Failure.Message, "content.en.language.nsfw.0") {
+		t.Errorf("expected sub/eicar.txt to fail listing its findings, got %+v", flagged)
+	}
+	if flagged.ClassName != "scanii.sub" || flagged.Time != "1.500" {
+		t.Errorf("unexpected class name or time: %+v", flagged)
+	}
+
+	locked := cases["locked.txt"]
+	if locked.Error == nil || locked.Error.Message != "permission denied" {
+		t.Errorf("expected locked.txt to error, got %+v", locked)
+	}
+}
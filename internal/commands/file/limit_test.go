@@ -0,0 +1,60 @@
+package file
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestLimiterPacesRequests(t *testing.T) {
+	l := newLimiter(100, 1)
+	started := time.Now()
+	for range 11 {
+		if err := l.wait(context.Background(), 1); err != nil {
+			t.Fatalf("wait: %s", err)
+		}
+	}
+	// the first request is free, the next ten take 10ms each
+	if elapsed := time.Since(started); elapsed < 90*time.Millisecond {
+		t.Errorf("expected about 100ms, took %s", elapsed)
+	}
+}
+
+func TestLimiterUnlimited(t *testing.T) {
+	if l := newLimiter(0, 1); l != nil {
+		t.Fatalf("expected no limiter for a zero rate, got %+v", l)
+	}
+	var l *limiter
+	if err := l.wait(context.Background(), 1e9); err != nil {
+		t.Errorf("expected a nil limiter to never wait, got %s", err)
+	}
+}
+
+func TestLimiterCancelled(t *testing.T) {
+	l := newLimiter(1, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := l.wait(ctx, 10); err == nil {
+		t.Error("expected a cancelled wait to fail")
+	}
+}
+
+func TestLimitedReader(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 2000)
+	r := &limitedReader{ctx: context.Background(), r: bytes.NewReader(data), l: newLimiter(20_000, 1000)}
+
+	started := time.Now()
+	got, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("read: %s", err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("data was altered")
+	}
+	// a 1000 byte burst then 1000 bytes at 20KB/s
+	if elapsed := time.Since(started); elapsed < 45*time.Millisecond {
+		t.Errorf("expected about 50ms, took %s", elapsed)
+	}
+}
@@ -0,0 +1,342 @@
+package file
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode"
+
+	"github.com/uvasoftware/scanii-cli/internal/vcs"
+	"gopkg.in/yaml.v3"
+)
+
+// metadataFlags holds the --metadata and --metadata-file values shared by
+// the files commands.
+type metadataFlags struct {
+	pairs []string
+	file  string
+}
+
+// parse validates and merges the metadata given, pairs from --metadata
+// taking precedence over those read from --metadata-file.
+func (m *metadataFlags) parse() (map[string]string, error) {
+	result := map[string]string{}
+	if m.file != "" {
+		content, err := os.ReadFile(m.file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read metadata file: %w", err)
+		}
+		// json is valid yaml, so both are read the same way
+		var values map[string]string
+		if err := yaml.Unmarshal(content, &values); err != nil {
+			return nil, fmt.Errorf("failed to parse metadata file %s, expected an object of string values: %w", m.file, err)
+		}
+		for k, v := range values {
+			if err := validateMetadataKey(k); err != nil {
+				return nil, err
+			}
+			result[k] = v
+		}
+	}
+	for _, pairs := range m.pairs {
+		if err := parseMetadataPairs(pairs, result); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := newMetadataTemplates(result, ""); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// staticMetadata expands metadata sent without a local file, as by fetch.
+// Only templates needing no file, such as the {{"{{"}} escape for a literal
+// {{, are expanded; the rest are rejected rather than sent verbatim.
+func staticMetadata(metadata map[string]string, command string) (map[string]string, error) {
+	expanded := make(map[string]string, len(metadata))
+	for _, k := range slices.Sorted(maps.Keys(metadata)) {
+		v := metadata[k]
+		if strings.Contains(v, "{{") {
+			var b strings.Builder
+			tmpl, err := template.New(k).Parse(v)
+			if err == nil {
+				// there is no file, so any field fails to evaluate
+				err = tmpl.Execute(&b, struct{}{})
+			}
+			if err != nil {
+				return nil, fmt.Errorf("invalid metadata %s, templates are only expanded for local files and not supported by %s", k, command)
+			}
+			v = b.String()
+		}
+		expanded[k] = v
+	}
+	return expanded, nil
+}
+
+// validateMetadataKey rejects keys that cannot be sent as metadata[key].
+func validateMetadataKey(k string) error {
+	if k == "" {
+		return errors.New("invalid metadata, keys cannot be empty")
+	}
+	if strings.ContainsAny(k, "[]") || strings.ContainsFunc(k, unicode.IsControl) {
+		return fmt.Errorf("invalid metadata key %q, keys cannot contain brackets or control characters", k)
+	}
+	return nil
+}
+
+// metadataEscapes are the characters a backslash escapes in metadata pairs,
+// any other backslash is kept as is so Windows paths need no escaping.
+const metadataEscapes = `,="\`
+
+// parseMetadataPairs parses comma separated key=value pairs into result.
+// Only the first = separates a key from its value, so values such as base64
+// need no escaping. Values holding commas are double quoted, as in
+// url="https://example.com/?a=1,2", or have them escaped with a backslash.
+func parseMetadataPairs(s string, result map[string]string) error {
+	runes := []rune(s)
+	i := 0
+	// read appends runes up to one of stop, resolving escapes
+	read := func(b *strings.Builder, stop string) {
+		for ; i < len(runes) && !strings.ContainsRune(stop, runes[i]); i++ {
+			if runes[i] == '\\' && i+1 < len(runes) && strings.ContainsRune(metadataEscapes, runes[i+1]) {
+				i++
+			}
+			b.WriteRune(runes[i])
+		}
+	}
+	skipSpaces := func() {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+	}
+
+	for ; i < len(runes); i++ {
+		var key, value strings.Builder
+		read(&key, "=,")
+		k := strings.TrimSpace(key.String())
+		if i == len(runes) || runes[i] == ',' {
+			if k == "" {
+				// blank entries, as in a trailing comma
+				continue
+			}
+			return fmt.Errorf("invalid metadata %q, expected key=value", k)
+		}
+		if err := validateMetadataKey(k); err != nil {
+			return err
+		}
+
+		i++
+		skipSpaces()
+		if i == len(runes) || runes[i] != '"' {
+			read(&value, ",")
+			result[k] = strings.TrimSpace(value.String())
+			continue
+		}
+
+		i++
+		read(&value, `"`)
+		if i == len(runes) {
+			return fmt.Errorf("invalid metadata %s, unterminated quote", k)
+		}
+		i++
+		skipSpaces()
+		if i < len(runes) && runes[i] != ',' {
+			return fmt.Errorf("invalid metadata %s, unexpected %q after the quoted value", k, string(runes[i:]))
+		}
+		result[k] = value.String()
+	}
+	return nil
+}
+
+// metadataTemplates expands metadata values written as text/template
+// templates, such as source={{.Path}}, once per uploaded file. It is safe
+// for concurrent use.
+type metadataTemplates struct {
+	// root is what file paths are made relative to
+	root     string
+	hostname string
+	// values holds the parsed templates keyed by their raw value
+	values map[string]*template.Template
+
+	mu      sync.Mutex
+	commits map[string]string
+}
+
+// newMetadataTemplates parses the metadata values that are templates, nil
+// is returned when there are none. Every value containing {{ is a template,
+// a literal {{ is written {{"{{"}}.
+func newMetadataTemplates(metadata map[string]string, root string) (*metadataTemplates, error) {
+	t := &metadataTemplates{root: root, values: map[string]*template.Template{}, commits: map[string]string{}}
+	funcs := template.FuncMap{"env": os.Getenv}
+	for k, v := range metadata {
+		if !strings.Contains(v, "{{") {
+			continue
+		}
+		tmpl, err := template.New(k).Funcs(funcs).Parse(v)
+		if err == nil {
+			// catches unknown fields before anything is uploaded
+			err = tmpl.Execute(io.Discard, &metadataFile{dryRun: true})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid template in metadata %s: %w", k, err)
+		}
+		t.values[v] = tmpl
+	}
+	if len(t.values) == 0 {
+		return nil, nil
+	}
+	t.hostname, _ = os.Hostname()
+	return t, nil
+}
+
+// commit returns the git commit of dir, looked up once per directory.
+func (t *metadataTemplates) commit(dir string) (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if c, ok := t.commits[dir]; ok {
+		return c, nil
+	}
+	c, err := vcs.Commit(dir)
+	if err != nil {
+		return "", err
+	}
+	t.commits[dir] = c
+	return c, nil
+}
+
+// metadataFile is what metadata templates are expanded with.
+type metadataFile struct {
+	// Path is relative to the scanned directory and slash separated
+	Path string
+	Name string
+	Size int64
+	// ModTime is empty for staged content, which has no modification time
+	ModTime string
+	// Hostname is the name of the machine uploading the file
+	Hostname string
+
+	t *metadataTemplates
+	// open reads the content for the checksum, nil when it cannot be read again
+	open func() (io.ReadCloser, error)
+	// dir is the directory whose git commit is reported
+	dir string
+	sum string
+	// dryRun skips reading the file, used to validate templates
+	dryRun bool
+}
+
+// SHA256 returns the checksum of the file's content.
+func (f *metadataFile) SHA256() (string, error) {
+	if f.dryRun || f.sum != "" || f.open == nil {
+		return f.sum, nil
+	}
+	fd, err := f.open()
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = fd.Close() }()
+	h := sha256.New()
+	if _, err := io.Copy(h, fd); err != nil {
+		return "", err
+	}
+	f.sum = fmt.Sprintf("%x", h.Sum(nil))
+	return f.sum, nil
+}
+
+// GitCommit returns the commit checked out in the repository holding the file.
+func (f *metadataFile) GitCommit() (string, error) {
+	if f.dryRun {
+		return "", nil
+	}
+	return f.t.commit(f.dir)
+}
+
+// expandMetadata returns metadata with its templates expanded for path.
+func (s *service) expandMetadata(path string, metadata map[string]string) (map[string]string, error) {
+	t := s.templates
+	if t == nil {
+		return metadata, nil
+	}
+
+	f := &metadataFile{Hostname: t.hostname, t: t}
+	// archive members are read from their extracted copy but otherwise
+	// described by the archive holding them
+	origin, content, member := path, path, ""
+	if file, name, ok := s.archives.lookup(path); ok {
+		origin = strings.TrimSuffix(path, memberSeparator+name)
+		content, member = file, name
+	}
+	if path == stdinPath {
+		f.Path, f.Name = s.stdinName, s.stdinName
+		f.dir = "."
+	} else {
+		rel, err := filepath.Rel(t.root, origin)
+		if err != nil || rel == "." {
+			// a single file was given
+			rel = filepath.Base(origin)
+		}
+		f.Path = filepath.ToSlash(rel)
+		f.Name = filepath.Base(path)
+		if member != "" {
+			f.Path += memberSeparator + member
+			f.Name = filepath.Base(member)
+		}
+		f.dir = filepath.Dir(origin)
+		if err := s.describeContent(f, path, origin, content); err != nil {
+			return nil, err
+		}
+	}
+
+	expanded := make(map[string]string, len(metadata))
+	for k, v := range metadata {
+		tmpl, ok := t.values[v]
+		if !ok {
+			expanded[k] = v
+			continue
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, f); err != nil {
+			return nil, fmt.Errorf("failed to expand metadata %s: %w", k, err)
+		}
+		expanded[k] = b.String()
+	}
+	return expanded, nil
+}
+
+// describeContent sets the size, modification time and checksum source of
+// f from what is uploaded for path: the staged copy under --git-staged, or
+// content on disk, dated by origin.
+func (s *service) describeContent(f *metadataFile, path, origin, content string) error {
+	if s.index.lookup(path) {
+		size, err := s.index.size(path)
+		if err != nil {
+			return err
+		}
+		f.Size = size
+		f.open = func() (io.ReadCloser, error) { return s.index.open(path) }
+		return nil
+	}
+
+	info, err := os.Stat(content)
+	if err != nil {
+		return err
+	}
+	f.Size = info.Size()
+	if origin != content {
+		if info, err = os.Stat(origin); err != nil {
+			return err
+		}
+	}
+	f.ModTime = info.ModTime().UTC().Format(time.RFC3339)
+	f.open = func() (io.ReadCloser, error) { return os.Open(content) }
+	return nil
+}
@@ -0,0 +1,255 @@
+package file
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"maps"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMetadataPairs(t *testing.T) {
+	tests := []struct {
+		name  string
+		pairs string
+		want  map[string]string
+	}{
+		{name: "empty", pairs: "", want: map[string]string{}},
+		{name: "single", pairs: "k1=v1", want: map[string]string{"k1": "v1"}},
+		{name: "multiple", pairs: "k1=v1,k2=v2", want: map[string]string{"k1": "v1", "k2": "v2"}},
+		{name: "whitespace", pairs: " k1 = v1 , k2 = v2 ", want: map[string]string{"k1": "v1", "k2": "v2"}},
+		{name: "equals in value", pairs: "token=YWJj==,q=a=b", want: map[string]string{"token": "YWJj==", "q": "a=b"}},
+		{name: "quoted", pairs: `url="https://example.com/?a=1,2" , k2=v2`, want: map[string]string{"url": "https://example.com/?a=1,2", "k2": "v2"}},
+		{name: "quoted spaces kept", pairs: `k1=" padded "`, want: map[string]string{"k1": " padded "}},
+		{name: "escaped", pairs: `list=a\,b,quote=say \"hi\",slash=a\\b`, want: map[string]string{"list": "a,b", "quote": `say "hi"`, "slash": `a\b`}},
+		{name: "windows path", pairs: `dir=C:\build\out`, want: map[string]string{"dir": `C:\build\out`}},
+		{name: "empty value", pairs: "k1=", want: map[string]string{"k1": ""}},
+		{name: "blank entries", pairs: "k1=v1,,k2=v2,", want: map[string]string{"k1": "v1", "k2": "v2"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := map[string]string{}
+			if err := parseMetadataPairs(tt.pairs, got); err != nil {
+				t.Fatalf("parseMetadataPairs: %s", err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseMetadataPairsInvalid(t *testing.T) {
+	for _, pairs := range []string{"k1=v1,invalid,k2=v2", "=v1", `k1="unterminated`, `k1="quoted" trailing`, "k[1]=v1"} {
+		if err := parseMetadataPairs(pairs, map[string]string{}); err == nil {
+			t.Errorf("expected %q to be rejected", pairs)
+		}
+	}
+}
+
+func TestMetadataFlags(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("write: %s", err)
+		}
+		return path
+	}
+
+	jsonFile := write("metadata.json", `{"team": "security", "url": "https://example.com/?a=1,b=2", "env": "staging"}`)
+	m := metadataFlags{pairs: []string{"env=production", "ticket=SEC-1,owner=ops"}, file: jsonFile}
+	got, err := m.parse()
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	want := map[string]string{"team": "security", "url": "https://example.com/?a=1,b=2", "env": "production", "ticket": "SEC-1", "owner": "ops"}
+	if !maps.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	yamlFile := write("metadata.yaml", "team: security\nbuild: 42\nnote: \"a, b = c\"\n")
+	got, err = (&metadataFlags{file: yamlFile}).parse()
+	if err != nil {
+		t.Fatalf("parse: %s", err)
+	}
+	if want := map[string]string{"team": "security", "build": "42", "note": "a, b = c"}; !maps.Equal(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	for name, m := range map[string]*metadataFlags{
+		"missing file":  {file: filepath.Join(dir, "missing.json")},
+		"nested values": {file: write("nested.yaml", "team:\n  name: security\n")},
+		"list":          {file: write("list.json", `["a", "b"]`)},
+		"bad key":       {file: write("key.json", `{"a]": "b"}`)},
+		"bad pair":      {pairs: []string{"novalue"}},
+		"bad template":  {pairs: []string{"source={{.Nope}}"}},
+	} {
+		if _, err := m.parse(); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestStaticMetadata(t *testing.T) {
+	md, err := staticMetadata(map[string]string{"team": "security", "url": "https://example.com/?a={b}", "literal": `{{"{{"}}x}}`}, "fetch")
+	if err != nil {
+		t.Fatalf("expected plain metadata to be accepted, got %s", err)
+	}
+	if md["url"] != "https://example.com/?a={b}" || md["literal"] != "{{x}}" {
+		t.Errorf("expected plain values kept and escapes expanded, got %v", md)
+	}
+	for _, v := range []string{"{{.Path}}", `{{env "HOME"}}`} {
+		_, err = staticMetadata(map[string]string{"team": "security", "source": v}, "fetch")
+		if err == nil || !strings.Contains(err.Error(), "source") || !strings.Contains(err.Error(), "fetch") {
+			t.Errorf("expected %q to be rejected, got %v", v, err)
+		}
+	}
+}
+
+func TestMetadataTemplates(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "sub", "file.txt")
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+	content := []byte("hello metadata")
+	if err := os.WriteFile(path, content, 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	mtime := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("chtimes: %s", err)
+	}
+	t.Setenv("SCANII_TEST_BUILD", "build-42")
+
+	metadata := map[string]string{
+		"static":   "value",
+		"source":   "{{.Path}}",
+		"name":     "{{.Name}}",
+		"size":     "{{.Size}}",
+		"mtime":    "{{.ModTime}}",
+		"sha256":   "{{.SHA256}}",
+		"build":    `{{env "SCANII_TEST_BUILD"}}`,
+		"combined": "{{.Hostname}}:{{.Path}}",
+		"literal":  `{{"{{"}}.Path}}`,
+	}
+	templates, err := newMetadataTemplates(metadata, root)
+	if err != nil {
+		t.Fatalf("newMetadataTemplates: %s", err)
+	}
+	s := &service{templates: templates}
+	expanded, err := s.expandMetadata(path, metadata)
+	if err != nil {
+		t.Fatalf("expandMetadata: %s", err)
+	}
+
+	hostname, _ := os.Hostname()
+	want := map[string]string{
+		"static":   "value",
+		"source":   "sub/file.txt",
+		"name":     "file.txt",
+		"size":     fmt.Sprint(len(content)),
+		"mtime":    "2024-05-06T07:08:09Z",
+		"sha256":   fmt.Sprintf("%x", sha256.Sum256(content)),
+		"build":    "build-42",
+		"combined": hostname + ":sub/file.txt",
+		"literal":  "{{.Path}}",
+	}
+	for k, v := range want {
+		if expanded[k] != v {
+			t.Errorf("expected %s to be %q, got %q", k, v, expanded[k])
+		}
+	}
+	if metadata["source"] != "{{.Path}}" {
+		t.Errorf("expected the templates to be left untouched, got %v", metadata)
+	}
+
+	// a single file is described relative to its own directory
+	s.templates, _ = newMetadataTemplates(metadata, path)
+	if expanded, _ = s.expandMetadata(path, metadata); expanded["source"] != "file.txt" {
+		t.Errorf("expected the file name as path, got %q", expanded["source"])
+	}
+}
+
+func TestMetadataTemplatesInvalid(t *testing.T) {
+	if templates, err := newMetadataTemplates(map[string]string{"a": "plain", "b": "x=y"}, "."); err != nil || templates != nil {
+		t.Fatalf("expected no templates, got %v %v", templates, err)
+	}
+	for _, v := range []string{"{{.Path", "{{.Unknown}}", "{{nope}}"} {
+		_, err := newMetadataTemplates(map[string]string{"source": v}, ".")
+		if err == nil || !strings.Contains(err.Error(), "source") {
+			t.Errorf("expected %q to be rejected, got %v", v, err)
+		}
+	}
+}
+
+func TestMetadataTemplatesGitCommit(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	root := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", root, "-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %s %s", args, err, out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	path := filepath.Join(root, "file.txt")
+	writeTestFile(t, path)
+	git("init", "-q")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	metadata := map[string]string{"commit": "{{.GitCommit}}"}
+	templates, err := newMetadataTemplates(metadata, root)
+	if err != nil {
+		t.Fatalf("newMetadataTemplates: %s", err)
+	}
+	s := &service{templates: templates}
+	expanded, err := s.expandMetadata(path, metadata)
+	if err != nil {
+		t.Fatalf("expandMetadata: %s", err)
+	}
+	if want := git("rev-parse", "HEAD"); expanded["commit"] != want {
+		t.Errorf("expected commit %s, got %s", want, expanded["commit"])
+	}
+
+	// outside of a repository the upload fails rather than sending an empty commit
+	outside := filepath.Join(t.TempDir(), "file.txt")
+	writeTestFile(t, outside)
+	if _, err := s.expandMetadata(outside, metadata); err == nil {
+		t.Error("expected an error outside of a repository")
+	}
+}
+
+func TestProcessExpandsMetadata(t *testing.T) {
+	svc := newTestService(t)
+	metadata := map[string]string{"source": "{{.Name}}", "team": "security"}
+	var err error
+	if svc.templates, err = newMetadataTemplates(metadata, filepath.Dir(fakeMalwareSample)); err != nil {
+		t.Fatalf("newMetadataTemplates: %s", err)
+	}
+
+	stream := make(chan string, 1)
+	stream <- fakeMalwareSample
+	close(stream)
+	var result resultRecord
+	if err := svc.process(context.Background(), stream, 1, "", false, metadata, func(r resultRecord) { result = r }); err != nil {
+		t.Fatalf("process: %s", err)
+	}
+	if result.err != nil {
+		t.Fatalf("unexpected error %s", result.err)
+	}
+	if result.metadata["source"] != filepath.Base(fakeMalwareSample) || result.metadata["team"] != "security" {
+		t.Errorf("expected expanded metadata, got %v", result.metadata)
+	}
+}
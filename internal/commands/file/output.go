@@ -0,0 +1,279 @@
+package file
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+)
+
+type outputFormat string
+
+const (
+	outputText   outputFormat = "text"
+	outputJSON   outputFormat = "json"
+	outputNDJSON outputFormat = "ndjson"
+	outputCSV    outputFormat = "csv"
+)
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch f := outputFormat(strings.ToLower(s)); f {
+	case "", outputText:
+		return outputText, nil
+	case outputJSON, outputNDJSON, outputCSV:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid output format %q, expected one of text, json, ndjson or csv", s)
+}
+
+// resultOutput is the machine-readable form of a resultRecord.
+type resultOutput struct {
+	Path          string            `json:"path,omitempty"`
+	ID            string            `json:"id,omitempty"`
+	Findings      []string          `json:"findings"`
+	Checksum      string            `json:"checksum,omitempty"`
+	ContentType   string            `json:"content_type,omitempty"`
+	ContentLength uint64            `json:"content_length,omitempty"`
+	CreationDate  string            `json:"creation_date,omitempty"`
+	Location      string            `json:"location,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Error         string            `json:"error,omitempty"`
+	Cached        bool              `json:"cached,omitempty"`
+}
+
+func newResultOutput(r *resultRecord) resultOutput {
+	o := resultOutput{
+		Path:          r.path,
+		ID:            r.id,
+		Findings:      r.findings,
+		Checksum:      r.checksum,
+		ContentType:   r.contentType,
+		ContentLength: r.contentLength,
+		CreationDate:  r.creationDate,
+		Location:      r.location,
+		Metadata:      r.metadata,
+		Cached:        r.cached,
+	}
+	if o.Findings == nil {
+		o.Findings = []string{}
+	}
+	if r.err != nil {
+		o.Error = r.err.Error()
+	}
+	return o
+}
+
+// record converts the output back into a resultRecord.
+func (o resultOutput) record() resultRecord {
+	r := resultRecord{
+		path:          o.Path,
+		id:            o.ID,
+		findings:      o.Findings,
+		checksum:      o.Checksum,
+		contentType:   o.ContentType,
+		contentLength: o.ContentLength,
+		creationDate:  o.CreationDate,
+		location:      o.Location,
+		metadata:      o.Metadata,
+		cached:        o.Cached,
+	}
+	if o.Error != "" {
+		r.err = errors.New(o.Error)
+	}
+	return r
+}
+
+var resultCSVHeader = []string{"path", "id", "findings", "checksum", "content_type", "content_length", "creation_date", "location", "metadata", "error"}
+
+func (o resultOutput) csvRow() []string {
+	length := ""
+	if o.ContentLength > 0 {
+		length = strconv.FormatUint(o.ContentLength, 10)
+	}
+	return []string{o.Path, o.ID, strings.Join(o.Findings, ";"), o.Checksum, o.ContentType, length, o.CreationDate, o.Location, joinMetadata(o.Metadata), o.Error}
+}
+
+// joinMetadata flattens metadata into sorted key=value pairs separated by semicolons.
+func joinMetadata(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ";")
+}
+
+type traceEventOutput struct {
+	Timestamp string `json:"timestamp,omitempty"`
+	Message   string `json:"message"`
+}
+
+// traceOutput is the machine-readable form of a traceRecord. Status and
+// Error are only set when several ids are traced at once.
+type traceOutput struct {
+	ID     string             `json:"id"`
+	Events []traceEventOutput `json:"events"`
+	Status string             `json:"status,omitempty"`
+	Error  string             `json:"error,omitempty"`
+}
+
+var (
+	traceCSVHeader       = []string{"id", "timestamp", "message"}
+	lookupTraceCSVHeader = append(traceCSVHeader[:len(traceCSVHeader):len(traceCSVHeader)], "status")
+)
+
+// lookupOutput is a result looked up by id along with its lookup status.
+type lookupOutput struct {
+	resultOutput
+	Status string `json:"status"`
+}
+
+var lookupCSVHeader = append(resultCSVHeader[:len(resultCSVHeader):len(resultCSVHeader)], "status")
+
+// output renders results in the format selected with --output. Text keeps
+// the human-friendly terminal rendering; json buffers every record into a
+// single array written on close; ndjson and csv stream one record at a
+// time. It is safe for concurrent use.
+type output struct {
+	format outputFormat
+	w      io.Writer
+
+	mu      sync.Mutex
+	csv     *csv.Writer
+	header  bool
+	pending []any
+}
+
+func newOutput(format outputFormat, w io.Writer) *output {
+	return &output{format: format, w: w}
+}
+
+// openOutput parses a --output value and, for machine-readable formats,
+// moves regular terminal output to stderr so stdout only carries results.
+func openOutput(format string) (*output, error) {
+	f, err := parseOutputFormat(format)
+	if err != nil {
+		return nil, err
+	}
+	if f != outputText {
+		terminal.SetOutput(os.Stderr)
+	}
+	return newOutput(f, os.Stdout), nil
+}
+
+// machine reports whether results are rendered in a machine-readable format.
+func (o *output) machine() bool {
+	return o.format != outputText
+}
+
+func (o *output) result(r *resultRecord) error {
+	if !o.machine() {
+		// a result spans several lines that must not interleave with another's
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		printFileResult(r)
+		return nil
+	}
+	row := newResultOutput(r)
+	return o.write(row, resultCSVHeader, [][]string{row.csvRow()})
+}
+
+func (o *output) trace(r *traceRecord) error {
+	if !o.machine() {
+		// a result spans several lines that must not interleave with another's
+		o.mu.Lock()
+		defer o.mu.Unlock()
+		printTraceResult(r)
+		return nil
+	}
+	t := traceOutput{ID: r.id, Events: make([]traceEventOutput, 0, len(r.events))}
+	rows := make([][]string, 0, len(r.events))
+	for _, e := range r.events {
+		t.Events = append(t.Events, traceEventOutput{Timestamp: e.timestamp, Message: e.message})
+		rows = append(rows, []string{r.id, e.timestamp, e.message})
+	}
+	return o.write(t, traceCSVHeader, rows)
+}
+
+// lookup writes a result retrieved by id along with its status, it is
+// only used in machine-readable formats.
+func (o *output) lookup(r *resultRecord, status string) error {
+	row := lookupOutput{resultOutput: newResultOutput(r), Status: status}
+	return o.write(row, lookupCSVHeader, [][]string{append(row.csvRow(), status)})
+}
+
+// lookupTrace writes a trace retrieved by id along with its status, a
+// failed lookup is a single row carrying the error in place of a message.
+func (o *output) lookupTrace(r *traceRecord, status string, err error) error {
+	t := traceOutput{ID: r.id, Events: make([]traceEventOutput, 0, len(r.events)), Status: status}
+	rows := make([][]string, 0, len(r.events))
+	for _, e := range r.events {
+		t.Events = append(t.Events, traceEventOutput{Timestamp: e.timestamp, Message: e.message})
+		rows = append(rows, []string{r.id, e.timestamp, e.message, status})
+	}
+	if err != nil {
+		t.Error = err.Error()
+		rows = append(rows, []string{r.id, "", t.Error, status})
+	} else if len(rows) == 0 {
+		rows = append(rows, []string{r.id, "", "", status})
+	}
+	return o.write(t, lookupTraceCSVHeader, rows)
+}
+
+func (o *output) write(v any, header []string, rows [][]string) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch o.format {
+	case outputJSON:
+		o.pending = append(o.pending, v)
+		return nil
+	case outputNDJSON:
+		return json.NewEncoder(o.w).Encode(v)
+	case outputCSV:
+		if o.csv == nil {
+			o.csv = csv.NewWriter(o.w)
+		}
+		if !o.header {
+			o.header = true
+			if err := o.csv.Write(header); err != nil {
+				return err
+			}
+		}
+		if err := o.csv.WriteAll(rows); err != nil {
+			return err
+		}
+		return nil
+	}
+	return nil
+}
+
+// close flushes buffered records, it must be called once all results are written.
+func (o *output) close() error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	switch o.format {
+	case outputJSON:
+		if o.pending == nil {
+			o.pending = []any{}
+		}
+		encoder := json.NewEncoder(o.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(o.pending)
+	case outputCSV:
+		if o.csv != nil {
+			o.csv.Flush()
+			return o.csv.Error()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package file
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+var outputFixtures = []resultRecord{
+	{
+		path:          "dir/malware",
+		id:            "abc",
+		findings:      []string{"content.malicious.local-test-file", "content.en.language.nsfw.0"},
+		checksum:      "7da9d3b0c68b1d0543acb65af4220a4745607557",
+		contentType:   "text/plain",
+		contentLength: 36,
+		metadata:      map[string]string{"b": "2", "a": "1"},
+	},
+	{path: "dir/missing", err: errors.New("open dir/missing: no such file or directory")},
+}
+
+func writeFixtures(t *testing.T, format outputFormat) string {
+	t.Helper()
+	var buf bytes.Buffer
+	out := newOutput(format, &buf)
+	for i := range outputFixtures {
+		if err := out.result(&outputFixtures[i]); err != nil {
+			t.Fatalf("result: %s", err)
+		}
+	}
+	if err := out.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	return buf.String()
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for _, valid := range []string{"", "text", "json", "NDJSON", "csv"} {
+		if _, err := parseOutputFormat(valid); err != nil {
+			t.Errorf("%q: unexpected error %s", valid, err)
+		}
+	}
+	if _, err := parseOutputFormat("xml"); err == nil {
+		t.Error("expected an error for an unknown format")
+	}
+}
+
+func TestOutputJSON(t *testing.T) {
+	var records []resultOutput
+	if err := json.Unmarshal([]byte(writeFixtures(t, outputJSON)), &records); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("want 2 records, got %d", len(records))
+	}
+	if records[0].ID != "abc" || len(records[0].Findings) != 2 || records[0].Metadata["a"] != "1" {
+		t.Errorf("unexpected first record: %+v", records[0])
+	}
+	if records[1].Error == "" || records[1].Findings == nil {
+		t.Errorf("expected an error and empty findings, got %+v", records[1])
+	}
+}
+
+func TestOutputJSONEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	out := newOutput(outputJSON, &buf)
+	if err := out.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	if strings.TrimSpace(buf.String()) != "[]" {
+		t.Errorf("want an empty array, got %s", buf.String())
+	}
+}
+
+func TestOutputNDJSON(t *testing.T) {
+	lines := strings.Split(strings.TrimSpace(writeFixtures(t, outputNDJSON)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("want 2 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		var r resultOutput
+		if err := json.Unmarshal([]byte(line), &r); err != nil {
+			t.Errorf("line %q: %s", line, err)
+		}
+	}
+}
+
+func TestOutputCSV(t *testing.T) {
+	rows, err := csv.NewReader(strings.NewReader(writeFixtures(t, outputCSV))).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %s", err)
+	}
+	if len(rows) != 3 {
+		t.Fatalf("want header and 2 rows, got %d", len(rows))
+	}
+	if strings.Join(rows[0], ",") != strings.Join(resultCSVHeader, ",") {
+		t.Errorf("unexpected header %v", rows[0])
+	}
+	if rows[1][2] != "content.malicious.local-test-file;content.en.language.nsfw.0" {
+		t.Errorf("unexpected findings column %q", rows[1][2])
+	}
+	if rows[1][8] != "a=1;b=2" {
+		t.Errorf("unexpected metadata column %q", rows[1][8])
+	}
+	if rows[2][9] == "" {
+		t.Error("expected the error column to be set")
+	}
+}
+
+func TestOutputTraceCSV(t *testing.T) {
+	var buf bytes.Buffer
+	out := newOutput(outputCSV, &buf)
+	record := &traceRecord{id: "abc", events: []traceEventRecord{
+		{timestamp: "2024-01-01T00:00:00Z", message: "received"},
+		{timestamp: "2024-01-01T00:00:01Z", message: "processed"},
+	}}
+	if err := out.trace(record); err != nil {
+		t.Fatalf("trace: %s", err)
+	}
+	if err := out.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+	want := "id,timestamp,message\nabc,2024-01-01T00:00:00Z,received\nabc,2024-01-01T00:00:01Z,processed\n"
+	if buf.String() != want {
+		t.Errorf("want %q, got %q", want, buf.String())
+	}
+}
@@ -0,0 +1,162 @@
+package file
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+)
+
+// Default exit codes used when a policy fails, 1 and 2 are left for
+// general errors such as bad flags or an unreachable endpoint.
+const (
+	defaultExitFindings = 3
+	defaultExitErrors   = 4
+	defaultExitBoth     = 5
+)
+
+// exitError is returned when a run completes but should exit with a
+// specific status code, main uses ExitCode to pick it.
+type exitError struct {
+	code int
+	msg  string
+}
+
+func (e *exitError) Error() string { return e.msg }
+
+// ExitCode returns the process exit code.
+func (e *exitError) ExitCode() int { return e.code }
+
+// policy decides whether a run fails based on the findings and errors in
+// every resultRecord. Findings matching a warnOn pattern are only reported,
+// findings matching a failOn pattern fail the run, with warnOn winning when
+// both match. Patterns use path.Match syntax, for example content.malicious.*.
+type policy struct {
+	failOn       []string
+	warnOn       []string
+	failOnError  bool
+	exitFindings int
+	exitErrors   int
+	exitBoth     int
+
+	mu     sync.Mutex
+	failed []resultRecord
+	warned []resultRecord
+	errors []resultRecord
+}
+
+func (p *policy) enabled() bool {
+	return len(p.failOn) > 0 || len(p.warnOn) > 0 || p.failOnError
+}
+
+// validate checks patterns and exit codes before any file is uploaded.
+func (p *policy) validate() error {
+	for _, pattern := range append(append([]string{}, p.failOn...), p.warnOn...) {
+		if err := validatePattern(pattern); err != nil {
+			return err
+		}
+	}
+	for _, code := range []int{p.exitFindings, p.exitErrors, p.exitBoth} {
+		if code < 1 || code > 125 {
+			return fmt.Errorf("invalid exit code %d, expected a value between 1 and 125", code)
+		}
+	}
+	return nil
+}
+
+// validatePattern checks a finding pattern is well formed.
+func validatePattern(pattern string) error {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return fmt.Errorf("invalid finding pattern %q: %w", pattern, err)
+	}
+	return nil
+}
+
+func matchesAny(patterns []string, finding string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, finding); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// classify splits findings into the ones that fail the run and the ones
+// that only warn, findings matching neither list are ignored.
+func (p *policy) classify(findings []string) (fail, warn []string) {
+	for _, f := range findings {
+		switch {
+		case matchesAny(p.warnOn, f):
+			warn = append(warn, f)
+		case matchesAny(p.failOn, f):
+			fail = append(fail, f)
+		}
+	}
+	return fail, warn
+}
+
+// evaluate records the policy outcome of a single result. It is safe for
+// concurrent use.
+func (p *policy) evaluate(r *resultRecord) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if r.err != nil {
+		if p.failOnError {
+			p.errors = append(p.errors, *r)
+		}
+		return
+	}
+
+	fail, warn := p.classify(r.findings)
+	if len(fail) > 0 {
+		failed := *r
+		failed.findings = fail
+		p.failed = append(p.failed, failed)
+	}
+	if len(warn) > 0 {
+		warned := *r
+		warned.findings = warn
+		p.warned = append(p.warned, warned)
+	}
+}
+
+// report prints the files that tripped the policy.
+func (p *policy) report() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.failed)+len(p.warned)+len(p.errors) == 0 {
+		return
+	}
+
+	terminal.Section("Policy")
+	for _, r := range p.failed {
+		terminal.Error(fmt.Sprintf("%s: %s", r.path, strings.Join(r.findings, ", ")))
+	}
+	for _, r := range p.errors {
+		terminal.Error(fmt.Sprintf("%s: %s", r.path, r.err))
+	}
+	for _, r := range p.warned {
+		terminal.Warn(fmt.Sprintf("%s: %s", r.path, strings.Join(r.findings, ", ")))
+	}
+}
+
+// verdict returns an exitError when the run violated the policy.
+func (p *policy) verdict() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	findings, errs := len(p.failed), len(p.errors)
+	switch {
+	case findings > 0 && errs > 0:
+		return &exitError{code: p.exitBoth, msg: fmt.Sprintf("policy failed: %d file(s) with findings and %d processing error(s)", findings, errs)}
+	case findings > 0:
+		return &exitError{code: p.exitFindings, msg: fmt.Sprintf("policy failed: %d file(s) with findings", findings)}
+	case errs > 0:
+		return &exitError{code: p.exitErrors, msg: fmt.Sprintf("policy failed: %d processing error(s)", errs)}
+	}
+	return nil
+}
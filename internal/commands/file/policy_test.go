@@ -0,0 +1,87 @@
+package file
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestPolicy(failOn, warnOn []string, failOnError bool) *policy {
+	return &policy{
+		failOn:       failOn,
+		warnOn:       warnOn,
+		failOnError:  failOnError,
+		exitFindings: defaultExitFindings,
+		exitErrors:   defaultExitErrors,
+		exitBoth:     defaultExitBoth,
+	}
+}
+
+func exitCode(t *testing.T, err error) int {
+	t.Helper()
+	if err == nil {
+		return 0
+	}
+	var coded *exitError
+	if !errors.As(err, &coded) {
+		t.Fatalf("expected an exitError, got %T", err)
+	}
+	return coded.ExitCode()
+}
+
+func TestPolicyVerdict(t *testing.T) {
+	malware := resultRecord{path: "a", findings: []string{"content.malicious.eicar-test-signature"}}
+	language := resultRecord{path: "b", findings: []string{"content.en.language.nsfw.0"}}
+	failure := resultRecord{path: "c", err: errors.New("boom")}
+	clean := resultRecord{path: "d"}
+
+	tests := []struct {
+		name    string
+		policy  *policy
+		records []resultRecord
+		want    int
+	}{
+		{"clean run", newTestPolicy([]string{"*"}, nil, true), []resultRecord{clean}, 0},
+		{"findings", newTestPolicy([]string{"content.malicious.*"}, nil, false), []resultRecord{malware, failure}, defaultExitFindings},
+		{"errors", newTestPolicy(nil, nil, true), []resultRecord{malware, failure}, defaultExitErrors},
+		{"both", newTestPolicy([]string{"*"}, nil, true), []resultRecord{malware, failure}, defaultExitBoth},
+		{"warn only", newTestPolicy([]string{"content.malicious.*"}, []string{"content.en.language.*"}, false), []resultRecord{language}, 0},
+		{"warn wins", newTestPolicy([]string{"*"}, []string{"content.en.language.*"}, false), []resultRecord{language, clean}, 0},
+		{"unmatched", newTestPolicy([]string{"content.image.*"}, nil, false), []resultRecord{malware, language}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := range tt.records {
+				tt.policy.evaluate(&tt.records[i])
+			}
+			if got := exitCode(t, tt.policy.verdict()); got != tt.want {
+				t.Errorf("want exit code %d, got %d", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestPolicyClassify(t *testing.T) {
+	p := newTestPolicy([]string{"content.malicious.*", "content.image.*"}, []string{"content.en.language.*"}, false)
+	fail, warn := p.classify([]string{"content.malicious.eicar-test-signature", "content.en.language.nsfw.0", "content.other"})
+	if len(fail) != 1 || fail[0] != "content.malicious.eicar-test-signature" {
+		t.Errorf("unexpected failing findings %v", fail)
+	}
+	if len(warn) != 1 || warn[0] != "content.en.language.nsfw.0" {
+		t.Errorf("unexpected warning findings %v", warn)
+	}
+}
+
+func TestPolicyValidate(t *testing.T) {
+	if err := newTestPolicy([]string{"content.[malicious"}, nil, false).validate(); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+	p := newTestPolicy([]string{"*"}, nil, false)
+	p.exitBoth = 0
+	if err := p.validate(); err == nil {
+		t.Error("expected an error for a zero exit code")
+	}
+	if err := newTestPolicy([]string{"content.malicious.*"}, nil, true).validate(); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
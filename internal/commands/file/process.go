@@ -3,82 +3,242 @@ package file
 import (
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
-	"strings"
 	"sync/atomic"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/uvasoftware/scanii-cli/internal/commands/profile"
 	"github.com/uvasoftware/scanii-cli/internal/terminal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
-func processCommand(ctx context.Context, profile, metadata *string) *cobra.Command {
-	concurrencyLimit := 32 * runtime.NumCPU()
-	ignoreHidden := false
-	var callback string
+func processCommand(ctx context.Context, profile *string, metadata *metadataFlags, outputFormat *string) *cobra.Command {
+	opts := processOptions{
+		concurrency: 32 * runtime.NumCPU(),
+		cacheTTL:    defaultCacheTTL,
+		retry:       defaultRetryPolicy(),
+		archive:     archiveLimits{maxEntries: defaultArchiveMaxEntries, maxSize: defaultArchiveMaxSize},
+	}
+	rules := &policy{}
+	actions := &remediation{}
+	noCache := false
 
 	cmd := &cobra.Command{
 		Use:        "process [flags] [path]",
 		Args:       cobra.ExactArgs(1),
 		ArgAliases: []string{"file/directory"},
 		Short:      "Process a local file or directory synchronously",
+		// caches, journals and reports are written once interrupted
+		Annotations: map[string]string{HandlesSignalsAnnotation: "true"},
 		Long: `Process a local file synchronously. The file can be a single file or a directory.
-If a directory is provided, all files in the directory will be processed recursively.`,
+If a directory is provided, all files in the directory will be processed recursively.
+Use - to read the content from standard input, named pipes are read the same way.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			parsedMetadata := extractMetadata(*metadata)
-			return process(ctx, *profile, args[0], parsedMetadata, concurrencyLimit, ignoreHidden, false, callback)
+			out, err := openOutput(*outputFormat)
+			if err != nil {
+				return err
+			}
+			if rules.enabled() {
+				if err := rules.validate(); err != nil {
+					return err
+				}
+				opts.policy = rules
+			}
+			if actions.enabled() {
+				if err := actions.validate(); err != nil {
+					return err
+				}
+				opts.remediation = actions
+			}
+			if opts.resume && opts.journal == "" {
+				return fmt.Errorf("--resume requires --journal")
+			}
+			switch {
+			case noCache:
+				opts.cacheFile = ""
+			case opts.cacheFile == "":
+				if opts.cacheFile, err = defaultCachePath(); err != nil {
+					return fmt.Errorf("failed to locate result cache: %w", err)
+				}
+			}
+			if opts.metadata, err = metadata.parse(); err != nil {
+				return err
+			}
+			opts.output = out
+			return process(ctx, *profile, args[0], opts)
 		},
 	}
 
-	cmd.PersistentFlags().StringVar(&callback, "callback", "", "Callback URL to be invoked when processing is complete")
-	cmd.PersistentFlags().IntVarP(&concurrencyLimit, "concurrency", "c", concurrencyLimit, "Number of concurrent requests to use")
-	cmd.PersistentFlags().BoolVarP(&ignoreHidden, "ignore-hidden", "i", false, "Ignore hidden files")
+	cmd.PersistentFlags().StringVar(&opts.callback, "callback", "", "Callback URL to be invoked when processing is complete")
+	cmd.PersistentFlags().IntVarP(&opts.concurrency, "concurrency", "c", opts.concurrency, "Number of concurrent requests to use")
+	addWalkFlags(cmd, &opts.walk)
+	addGitFlags(cmd, &opts.git)
+	addRetryFlags(cmd, &opts.retry)
+	addLimitFlags(cmd, &opts)
+	cmd.PersistentFlags().StringVar(&opts.filename, "filename", "", "File name reported for content read from standard input or a named pipe, defaults to stdin or the pipe's name")
+	cmd.PersistentFlags().BoolVar(&opts.expandArchives, "expand-archives", false, "Open zip, tar and tar.gz archives locally and upload each member on its own, reported as archive.zip!/dir/file")
+	cmd.PersistentFlags().IntVar(&opts.archive.maxEntries, "archive-max-entries", opts.archive.maxEntries, "Fail an expanded archive with more entries than this, 0 is unlimited")
+	cmd.PersistentFlags().Var(&opts.archive.maxSize, "archive-max-size", "Fail an expanded archive that unpacks to more than this size, 0 is unlimited")
+	cmd.PersistentFlags().StringVar(&opts.journal, "journal", "", "Record every completed file and its result to this file so an interrupted run can be resumed")
+	cmd.PersistentFlags().BoolVar(&opts.resume, "resume", false, "Skip files completed in --journal and replay their results, failed files are tried again")
+	cmd.PersistentFlags().BoolVar(&noCache, "no-cache", false, "Upload every file, ignoring and not updating the local result cache")
+	cmd.PersistentFlags().StringVar(&opts.cacheFile, "cache-file", "", "Location of the local result cache, defaults to scanii-cli/results.json in the user cache directory")
+	cmd.PersistentFlags().DurationVar(&opts.cacheTTL, "cache-ttl", opts.cacheTTL, "How long a cached result is reused for an unchanged file, 0 never expires")
+	cmd.PersistentFlags().StringSliceVar(&rules.failOn, "fail-on", nil, "Exit non-zero when a finding matches this pattern, e.g. 'content.malicious.*', can be repeated")
+	cmd.PersistentFlags().StringSliceVar(&rules.warnOn, "warn-on", nil, "Only warn when a finding matches this pattern, takes precedence over --fail-on, can be repeated")
+	cmd.PersistentFlags().BoolVar(&rules.failOnError, "fail-on-error", false, "Exit non-zero when a file cannot be processed")
+	cmd.PersistentFlags().IntVar(&rules.exitFindings, "exit-code-findings", defaultExitFindings, "Exit code used when findings fail the policy")
+	cmd.PersistentFlags().IntVar(&rules.exitErrors, "exit-code-errors", defaultExitErrors, "Exit code used when processing errors fail the policy")
+	cmd.PersistentFlags().IntVar(&rules.exitBoth, "exit-code-both", defaultExitBoth, "Exit code used when both findings and processing errors fail the policy")
+	addActionFlags(cmd, actions)
+	cmd.PersistentFlags().StringVar(&opts.sarif, "sarif", "", "Write a SARIF 2.1 report of findings and processing errors to this file")
+	cmd.PersistentFlags().StringVar(&opts.junit, "junit", "", "Write a JUnit XML report with a test case per file to this file")
 
 	return cmd
 }
 
-func asyncCommand(ctx context.Context, profile, metadata *string) *cobra.Command {
-	concurrencyLimit := 32 * runtime.NumCPU()
-	ignoreHidden := false
-	var callback string
+func asyncCommand(ctx context.Context, profile *string, metadata *metadataFlags, outputFormat *string) *cobra.Command {
+	opts := processOptions{
+		concurrency: 32 * runtime.NumCPU(),
+		async:       true,
+		retry:       defaultRetryPolicy(),
+		poll:        retryPolicy{delay: defaultPollInterval, maxDelay: defaultPollMaxDelay},
+		waitTimeout: defaultWaitTimeout,
+	}
 
 	cmd := &cobra.Command{
-		Use:        "async [flags] [file]",
-		Short:      "Process a local file or directory asynchronously",
-		Args:       cobra.ExactArgs(1),
-		ArgAliases: []string{"file/directory"},
+		Use:   "async [flags] [file]",
+		Short: "Process a local file or directory asynchronously",
+		// journals and reports are written once interrupted
+		Annotations: map[string]string{HandlesSignalsAnnotation: "true"},
+		Args:        cobra.ExactArgs(1),
+		ArgAliases:  []string{"file/directory"},
+		Long: `Submit a local file or directory for asynchronous processing and print the id of each submission.
+With --wait, the results are polled for and reported as they would be by process.`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			parsedMetadata := extractMetadata(*metadata)
-			return process(ctx, *profile, args[0], parsedMetadata, concurrencyLimit, ignoreHidden, true, callback)
+			if opts.poll.delay <= 0 {
+				return fmt.Errorf("--poll-interval must be positive")
+			}
+			out, err := openOutput(*outputFormat)
+			if err != nil {
+				return err
+			}
+			if opts.metadata, err = metadata.parse(); err != nil {
+				return err
+			}
+			opts.output = out
+			return process(ctx, *profile, args[0], opts)
 		},
 	}
 
-	cmd.PersistentFlags().StringVar(&callback, "callback", "", "Callback URL to be invoked when processing is complete")
-	cmd.PersistentFlags().IntVarP(&concurrencyLimit, "concurrency", "c", concurrencyLimit, "Number of concurrent requests to use")
-	cmd.PersistentFlags().BoolVarP(&ignoreHidden, "ignore-hidden", "i", false, "Ignore hidden files")
+	cmd.PersistentFlags().StringVar(&opts.callback, "callback", "", "Callback URL to be invoked when processing is complete")
+	cmd.PersistentFlags().IntVarP(&opts.concurrency, "concurrency", "c", opts.concurrency, "Number of concurrent requests to use")
+	addWalkFlags(cmd, &opts.walk)
+	addRetryFlags(cmd, &opts.retry)
+	addLimitFlags(cmd, &opts)
+	cmd.PersistentFlags().StringVar(&opts.filename, "filename", "", "File name reported for content read from standard input or a named pipe, defaults to stdin or the pipe's name")
+	cmd.PersistentFlags().BoolVar(&opts.wait, "wait", false, "Wait for every submission to complete and report the results as process does")
+	cmd.PersistentFlags().DurationVar(&opts.poll.delay, "poll-interval", opts.poll.delay, "Initial delay between polls for a pending result, doubled on each poll with jitter")
+	cmd.PersistentFlags().DurationVar(&opts.waitTimeout, "wait-timeout", opts.waitTimeout, "How long to wait for a single result before reporting it as failed, 0 waits forever")
 
 	return cmd
 }
 
-func process(
-	ctx context.Context,
-	profileName string,
-	path string,
-	metadata map[string]string,
-	concurrencyLimit int,
-	ignoreHidden bool,
-	async bool,
-	callback string,
-) error {
+// addWalkFlags registers the flags selecting which files a directory walk picks up.
+func addWalkFlags(cmd *cobra.Command, opts *walkOptions) {
+	cmd.PersistentFlags().BoolVarP(&opts.ignoreHidden, "ignore-hidden", "i", false, "Ignore hidden files")
+	cmd.PersistentFlags().StringArrayVar(&opts.include, "include", nil, "Only process files matching this glob, ** matches any number of directories, can be repeated")
+	cmd.PersistentFlags().StringArrayVar(&opts.exclude, "exclude", nil, "Skip files and directories matching this glob, can be repeated")
+	cmd.PersistentFlags().IntVar(&opts.maxDepth, "max-depth", 0, "Maximum directory depth to descend into, 1 only processes the top level, 0 is unlimited")
+	cmd.PersistentFlags().Var(&opts.maxSize, "max-size", "Skip files larger than this size, e.g. 10MB or 1GiB")
+	cmd.PersistentFlags().Var(&opts.minSize, "min-size", "Skip files smaller than this size, e.g. 1KB")
+	cmd.PersistentFlags().BoolVar(&opts.followSymlinks, "follow-symlinks", false, "Follow symbolic links instead of skipping them, links looping back into the walk are skipped")
+}
+
+// addActionFlags registers the flags selecting what is done to files with matching findings.
+func addActionFlags(cmd *cobra.Command, actions *remediation) {
+	cmd.PersistentFlags().StringVar(&actions.action, "action", "", "Action taken on files with findings matching --action-on: move, delete, rename or strip-permissions")
+	cmd.PersistentFlags().StringSliceVar(&actions.on, "action-on", []string{"content.malicious.*"}, "Finding pattern that triggers --action, can be repeated")
+	cmd.PersistentFlags().StringVar(&actions.dir, "quarantine-dir", "", "Directory files are moved into by --action move, keeping their path relative to the scanned directory")
+	cmd.PersistentFlags().StringVar(&actions.suffix, "rename-suffix", defaultRenameSuffix, "Suffix appended by --action rename")
+	cmd.PersistentFlags().BoolVar(&actions.dryRun, "dry-run", false, "Report the actions that would be taken without changing any file")
+	cmd.PersistentFlags().StringVar(&actions.logPath, "action-log", "", "Append every action taken to this file as newline-delimited JSON")
+}
+
+// addRetryFlags registers the flags controlling how transient upload failures are retried.
+func addRetryFlags(cmd *cobra.Command, retry *retryPolicy) {
+	cmd.PersistentFlags().IntVar(&retry.retries, "retries", retry.retries, "Times to retry a file after a network error, 429 or 5xx response, 0 disables retries")
+	cmd.PersistentFlags().DurationVar(&retry.delay, "retry-delay", retry.delay, "Initial delay between retries, doubled on each retry with jitter")
+	cmd.PersistentFlags().DurationVar(&retry.maxDelay, "retry-max-delay", retry.maxDelay, "Maximum delay between retries, a longer Retry-After from the server is still honored")
+}
+
+// addLimitFlags registers the flags pacing uploads across all workers.
+func addLimitFlags(cmd *cobra.Command, opts *processOptions) {
+	cmd.PersistentFlags().Float64Var(&opts.rate, "rate", 0, "Maximum upload requests per second across all workers, 0 is unlimited")
+	cmd.PersistentFlags().Var(&opts.bandwidth, "bandwidth", "Maximum upload bytes per second across all workers, e.g. 10MB, 0 is unlimited")
+}
+
+// processOptions holds the settings shared by the process and async commands.
+type processOptions struct {
+	metadata    map[string]string
+	concurrency int
+	walk        walkOptions
+	async       bool
+	callback    string
+	output      *output
+	// sarif and junit are the paths of reports written once processing completes
+	sarif string
+	junit string
+	// policy, when set, turns findings and errors into a non-zero exit code
+	policy *policy
+	// remediation, when set, acts on files with matching findings
+	remediation *remediation
+	// journal records every result as it completes, resume skips the files
+	// it lists as completed and replays their results instead
+	journal string
+	resume  bool
+	// cacheFile is the result cache consulted before uploading, empty disables it
+	cacheFile string
+	cacheTTL  time.Duration
+	retry     retryPolicy
+	// rate and bandwidth limit requests and bytes per second, zero is unlimited
+	rate      float64
+	bandwidth byteSize
+	// expandArchives uploads each member of zip and tar archives on its own
+	expandArchives bool
+	archive        archiveLimits
+	// filename names content streamed from standard input or a named pipe
+	filename string
+	// git, when enabled, selects the files to process from a repository
+	git gitSelection
+	// wait polls for the results of async submissions, spaced by poll and
+	// given up on after waitTimeout
+	wait        bool
+	poll        retryPolicy
+	waitTimeout time.Duration
+}
+
+// collect reports whether every result must be kept for end of run reports.
+func (o processOptions) collect() bool {
+	return o.sarif != "" || o.junit != ""
+}
+
+func process(ctx context.Context, profileName string, path string, opts processOptions) error {
+	out := opts.output
+	if out == nil {
+		out = newOutput(outputText, os.Stdout)
+	}
+
 	// counters
 	filesStarted := atomic.Uint64{}
-	filesFinished := atomic.Uint64{}
-	filesFailed := atomic.Uint64{}
-	filesWithFindings := atomic.Uint64{}
+	// membersDelta adjusts filesTotal as archives are expanded into their members
+	membersDelta := atomic.Int64{}
 	isDirectory := false
 	filesTotal := uint64(0)
 	bytesTotal := uint64(0)
@@ -98,105 +258,307 @@ func process(
 		}
 	}
 
-	info, err := os.Stat(path)
+	// files already quarantined or renamed are not scanned again
+	if opts.remediation != nil {
+		opts.walk.exclude = append(opts.walk.exclude, opts.remediation.exclusions(path)...)
+	}
+
+	// patterns are validated before anything is uploaded
+	filter, err := newWalkFilter(opts.walk)
 	if err != nil {
-		return fmt.Errorf("failed to stat path: %w", err)
+		return err
 	}
 
-	if info.IsDir() {
-		isDirectory = true
-		err = fsWalker(path, ignoreHidden, func(_ string, it os.DirEntry) {
-			fi, err := it.Info()
+	if opts.git.enabled() {
+		if opts.walk.files, err = opts.git.files(path); err != nil {
+			return err
+		}
+		if opts.walk.staged, err = opts.git.index(path); err != nil {
+			return err
+		}
+		opts.metadata = gitMetadata(path, opts.metadata)
+	}
+
+	// standard input and named pipes are streamed, their length is unknown
+	var source io.Reader
+	var stream *progressReader
+	if path == stdinPath {
+		source = os.Stdin
+	} else {
+		info, err := os.Stat(path)
+		if err != nil {
+			return fmt.Errorf("failed to stat path: %w", err)
+		}
+
+		switch {
+		case info.Mode()&os.ModeNamedPipe != 0:
+			fd, err := os.Open(path)
 			if err != nil {
-				return
+				return fmt.Errorf("failed to open pipe: %w", err)
 			}
-			bytesTotal += uint64(fi.Size()) //nolint:gosec
-			filesTotal++
-		})
+			defer func() { _ = fd.Close() }()
+			source = fd
+			if opts.filename == "" {
+				opts.filename = filepath.Base(path)
+			}
+		case info.IsDir():
+			isDirectory = true
+			err = fsWalker(path, opts.walk, func(_ string, it os.DirEntry) {
+				fi, err := it.Info()
+				if err != nil {
+					return
+				}
+				bytesTotal += uint64(fi.Size()) //nolint:gosec
+				filesTotal++
+			})
 
-		if err != nil {
-			return fmt.Errorf("failed to walk directory: %w", err)
+			if err != nil {
+				return fmt.Errorf("failed to walk directory: %w", err)
+			}
+			if opts.git.enabled() {
+				terminal.Info(fmt.Sprintf("Processing %s file(s) selected from git in %s | ~%s", terminal.FormatNumber(int64(filesTotal)), path, terminal.FormatBytes(bytesTotal))) //nolint:gosec
+			} else {
+				terminal.Info(fmt.Sprintf("Processing recursive directory %s with ~%s files | ~%s", path, terminal.FormatNumber(int64(filesTotal)), terminal.FormatBytes(bytesTotal))) //nolint:gosec
+			}
+		default:
+			reason := filter.skip(filepath.Base(path), false)
+			if reason == "" {
+				reason = filter.skipFile(info)
+			}
+			if reason != "" {
+				slog.Debug("ignoring filtered file", "path", path, "reason", reason)
+				terminal.Info(fmt.Sprintf("Skipping file %s, %s", path, reason))
+				return nil
+			}
+			filesTotal = 1
+			terminal.Info(fmt.Sprintf("Processing file %s", path))
+			bytesTotal += uint64(info.Size()) //nolint:gosec
 		}
-		terminal.Info(fmt.Sprintf("Processing recursive directory %s with ~%s files | ~%s", path, terminal.FormatNumber(int64(filesTotal)), terminal.FormatBytes(bytesTotal))) //nolint:gosec
-	} else {
-		if ignoreHidden && strings.HasPrefix(filepath.Base(path), ".") {
-			slog.Debug("ignoring hidden file", "path", path)
-			terminal.Info(fmt.Sprintf("Skipping hidden file %s", path))
-			return nil
+	}
+	if source != nil {
+		if opts.filename == "" {
+			opts.filename = defaultStdinName
 		}
 		filesTotal = 1
-		terminal.Info(fmt.Sprintf("Processing file %s", path))
-		bytesTotal += uint64(info.Size()) //nolint:gosec
+		terminal.Info(fmt.Sprintf("Processing stream as %s", opts.filename))
+		// the name is kept with the result since there is no path to identify it by
+		opts.metadata = withMetadata(opts.metadata, "filename", opts.filename)
 	}
 
-	fileChannel := make(chan string)
-	go func() {
-		err = fsWalker(path, ignoreHidden, func(filePath string, _ os.DirEntry) {
-			filesStarted.Add(1)
-			fileChannel <- filePath
-		})
+	fs, err := newUploadService(p, opts, path)
+	if err != nil {
+		return err
+	}
+	fs.index = opts.walk.staged
+	if opts.expandArchives {
+		if fs.archives, err = newExpander(opts.archive); err != nil {
+			return err
+		}
+		defer func() { _ = fs.archives.close() }()
+	}
+	if source != nil {
+		stream = &progressReader{r: source, show: !out.machine() && !slog.Default().Enabled(ctx, slog.LevelDebug)}
+		fs.stdin = stream
+		fs.stdinName = opts.filename
+	}
+	if opts.cacheFile != "" && !opts.async {
+		fs.cache, err = loadResultCache(opts.cacheFile, p.Endpoint, opts.cacheTTL)
 		if err != nil {
-			filesFailed.Add(1)
-			slog.Error("failed to walk directory", "error", err)
+			// a damaged cache only costs re-uploads, it is replaced on save
+			terminal.Warn(fmt.Sprintf("Ignoring result cache: %s", err))
+			fs.cache = newResultCache(opts.cacheFile, p.Endpoint, opts.cacheTTL)
 		}
-		close(fileChannel)
-	}()
+		defer func() {
+			if err := fs.cache.save(); err != nil {
+				terminal.Warn(fmt.Sprintf("Failed to save result cache: %s", err))
+			}
+		}()
+	}
 
-	bytesProcessed := uint64(0)
+	results := newResultConsumer(out, opts)
+	results.archives = fs.archives
+
+	completed := map[string]resultRecord{}
+	if opts.journal != "" {
+		if opts.resume {
+			if completed, err = readJournal(opts.journal); err != nil {
+				return err
+			}
+			terminal.Info(fmt.Sprintf("Resuming from %s, %s file(s) already completed", opts.journal, terminal.FormatNumber(int64(len(completed)))))
+		}
+		if results.journal, err = openJournal(opts.journal, opts.resume); err != nil {
+			return fmt.Errorf("failed to open journal: %w", err)
+		}
+		defer func() { _ = results.journal.close() }()
+	}
+
+	// skipped files are only counted on the upload pass
+	skipped := &skipCounts{}
+	walk := opts.walk
+	walk.onSkip = skipped.add
+
+	ctx, span := tracer.Start(ctx, "files.process", trace.WithAttributes(attribute.String("path", path), attribute.Bool("async", opts.async)))
+	defer span.End()
 
 	startTime := time.Now()
-	fs, err := newService(p)
-	err = fs.process(ctx, fileChannel, concurrencyLimit, callback, async, metadata, func(result resultRecord) {
-		if result.err != nil {
-			slog.Error("failed to process file", "file", result.path, "error", result.err)
-			filesFailed.Add(1)
-		} else {
-			filesFinished.Add(1)
+	if isDirectory {
+		results.progress = func() {
+			finished, failed := results.finished.Load(), results.failed.Load()
+			slog.Debug("progress", "files_started", filesStarted.Load(), "files_finished", finished, "files_failed", failed, "files_with_findings", results.withFindings.Load(), "total_files", filesTotal)
+			if !slog.Default().Enabled(ctx, slog.LevelDebug) {
+				terminal.ProgressBar("Files", finished+failed, uint64(int64(filesTotal)+membersDelta.Load())) //nolint:gosec
+			}
 		}
+	}
 
-		// increment bytes processed
-		bytesProcessed += result.contentLength
-		if len(result.findings) > 0 {
-			filesWithFindings.Add(1)
+	// reports and quarantined files use paths relative to root
+	root := path
+	if !isDirectory {
+		root = filepath.Dir(path)
+	}
+	if opts.remediation != nil {
+		if err := opts.remediation.open(root); err != nil {
+			return err
 		}
-		if isDirectory {
-			slog.Debug("progress", "files_started", filesStarted.Load(), "files_finished", filesFinished.Load(), "files_failed", filesFailed.Load(), "files_with_findings", filesWithFindings.Load(), "total_files", filesTotal)
-			if !slog.Default().Enabled(ctx, slog.LevelDebug) {
-				terminal.ProgressBar("Files", filesFinished.Load()+filesFailed.Load(), filesTotal)
+		defer func() { _ = opts.remediation.close() }()
+	}
+
+	// accepted async submissions are finished once their results are in
+	var pending *poller
+	if opts.async && opts.wait {
+		pending = newPoller(fs, opts.poll, opts.waitTimeout, opts.concurrency)
+	}
+
+	fileChannel := make(chan string)
+	go func() {
+		if source != nil {
+			filesStarted.Add(1)
+			fileChannel <- stdinPath
+			close(fileChannel)
+			return
+		}
+		// send queues a path for upload unless a journal already completed it
+		send := func(filePath string) {
+			filesStarted.Add(1)
+			if r, ok := completed[filePath]; ok {
+				results.replay(r)
+				return
+			}
+			// once interrupted the rest of the walk is left for a resumed run
+			select {
+			case fileChannel <- filePath:
+			case <-ctx.Done():
 			}
-		} else {
-			printFileResult(&result)
 		}
+		walkErr := fsWalker(path, walk, func(filePath string, _ os.DirEntry) {
+			if fs.archives == nil || !isArchive(filePath) {
+				send(filePath)
+				return
+			}
+			members, err := fs.archives.expand(filePath)
+			if err != nil {
+				slog.Error("failed to expand archive", "path", filePath, "error", err)
+				filesStarted.Add(1)
+				results.consume(resultRecord{path: filePath, err: fmt.Errorf("failed to expand archive: %w", err)})
+				return
+			}
+			// the archive was counted as one file, its members replace it
+			membersDelta.Add(int64(len(members)) - 1)
+			for _, member := range members {
+				send(member)
+			}
+		})
+		if walkErr != nil {
+			results.failed.Add(1)
+			slog.Error("failed to walk directory", "error", walkErr)
+		}
+		close(fileChannel)
+	}()
 
+	err = fs.process(ctx, fileChannel, opts.concurrency, opts.callback, opts.async, opts.metadata, func(result resultRecord) {
+		results.journaled(&result)
+		if pending != nil && result.err == nil {
+			pending.wait(ctx, result, results.finish)
+			return
+		}
+		results.finish(result)
 	})
+	if pending != nil {
+		pending.close()
+	}
 	if err != nil {
 		return err
 	}
+	if err := out.close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+
+	if opts.sarif != "" {
+		if err := writeReport(opts.sarif, func(w io.Writer) error { return writeSARIF(w, root, results.records) }); err != nil {
+			return fmt.Errorf("failed to write sarif report: %w", err)
+		}
+		terminal.Info(fmt.Sprintf("SARIF report written to %s", opts.sarif))
+	}
+	if opts.junit != "" {
+		if err := writeReport(opts.junit, func(w io.Writer) error { return writeJUnit(w, root, results.records, startTime, time.Since(startTime)) }); err != nil {
+			return fmt.Errorf("failed to write junit report: %w", err)
+		}
+		terminal.Info(fmt.Sprintf("JUnit report written to %s", opts.junit))
+	}
+	if stream != nil {
+		bytesTotal = stream.n.Load()
+	}
 	elapsed := time.Since(startTime)
 	throughput := float64(bytesTotal) / elapsed.Seconds()
 
-	fmt.Println()
-	terminal.Success(fmt.Sprintf("Completed in %s, %s file(s) analyzed. Throughput %s/s", terminal.FormatDuration(elapsed), terminal.FormatNumber(int64(filesFinished.Load())), terminal.FormatBytes(uint64(throughput)))) //nolint:gosec
-	terminal.Success(fmt.Sprintf("Files with findings: %d, unable to process: %d and successfully processed: %d", filesWithFindings.Load(), filesFailed.Load(), filesFinished.Load()))
+	var notes []string
+	if fs.cache != nil {
+		hits := fs.cache.hits.Load()
+		notes = append(notes, fmt.Sprintf("Cache hits: %d, files uploaded: %d", hits, results.finished.Load()+results.failed.Load()-hits-results.resumed.Load()))
+	}
+	if n := results.resumed.Load(); n > 0 {
+		notes = append(notes, fmt.Sprintf("Resumed: %d file(s) replayed from %s", n, opts.journal))
+	}
+	if n := skipped.total(); n > 0 {
+		notes = append(notes, fmt.Sprintf("Skipped %d file(s), %s", n, skipped))
+	}
+	verdict := results.printSummary(fmt.Sprintf("Completed in %s, %s file(s) analyzed. Throughput %s/s", terminal.FormatDuration(elapsed), terminal.FormatNumber(int64(results.finished.Load())), terminal.FormatBytes(uint64(throughput))), notes...) //nolint:gosec
+	if ctx.Err() != nil {
+		// a policy verdict only covers the files processed so far
+		return fmt.Errorf("interrupted: %w", ctx.Err())
+	}
+	return verdict
+}
 
-	return nil
+// newUploadService returns a service uploading as opts ask, templates are
+// expanded relative to root.
+func newUploadService(p *profile.Profile, opts processOptions, root string) (*service, error) {
+	fs, err := newService(p)
+	if err != nil {
+		return nil, err
+	}
+	fs.retry = opts.retry
+	if fs.templates, err = newMetadataTemplates(opts.metadata, root); err != nil {
+		return nil, err
+	}
+	// requests are spread evenly, bandwidth may burst up to a second's worth
+	fs.requests = newLimiter(opts.rate, 1)
+	fs.bandwidth = newLimiter(float64(opts.bandwidth), float64(opts.bandwidth))
+	if opts.rate > 0 || opts.bandwidth > 0 {
+		slog.Debug("limiting uploads", "rate", opts.rate, "bandwidth", int64(opts.bandwidth))
+	}
+	return fs, nil
 }
 
-func fsWalker(root string, ignoreHidden bool, handler func(path string, d os.DirEntry)) error {
-	return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
-		if err != nil {
-			return err
-		}
-		if ignoreHidden && strings.HasPrefix(filepath.Base(path), ".") {
-			if d.IsDir() {
-				return filepath.SkipDir
-			}
-			slog.Debug("ignoring hidden file", "path", path)
-			return nil
-		}
-		if !d.IsDir() {
-			handler(path, d)
-		}
-		return nil
-	})
+// writeReport creates path and renders a report into it.
+func writeReport(path string, render func(w io.Writer) error) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := render(fd); err != nil {
+		_ = fd.Close()
+		return err
+	}
+	return fd.Close()
 }
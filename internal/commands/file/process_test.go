@@ -9,7 +9,7 @@ import (
 
 func TestFsWalkerSingleFile(t *testing.T) {
 	var visited []string
-	err := fsWalker(fakeMalwareSample, false, func(path string, d os.DirEntry) {
+	err := fsWalker(fakeMalwareSample, walkOptions{}, func(path string, d os.DirEntry) {
 		visited = append(visited, d.Name())
 	})
 	if err != nil {
@@ -41,7 +41,7 @@ func TestFsWalkerDirectory(t *testing.T) {
 	}
 
 	var visited []string
-	err := fsWalker(dir, false, func(path string, d os.DirEntry) {
+	err := fsWalker(dir, walkOptions{}, func(path string, d os.DirEntry) {
 		visited = append(visited, d.Name())
 	})
 	if err != nil {
@@ -62,7 +62,7 @@ func TestFsWalkerSkipsDirectories(t *testing.T) {
 	}
 
 	var visited []string
-	err := fsWalker(dir, false, func(path string, d os.DirEntry) {
+	err := fsWalker(dir, walkOptions{}, func(path string, d os.DirEntry) {
 		visited = append(visited, d.Name())
 		if d.IsDir() {
 			t.Fatalf("handler should not be called with directory, got %s", d.Name())
@@ -77,7 +77,7 @@ func TestFsWalkerSkipsDirectories(t *testing.T) {
 }
 
 func TestFsWalkerNonExistentPath(t *testing.T) {
-	err := fsWalker("/tmp/does_not_exist_at_all", false, func(path string, d os.DirEntry) {
+	err := fsWalker("/tmp/does_not_exist_at_all", walkOptions{}, func(path string, d os.DirEntry) {
 		t.Fatal("should not be called")
 	})
 	if err == nil {
@@ -96,7 +96,7 @@ func TestFsWalkerPassesFilePath(t *testing.T) {
 	}
 
 	var paths []string
-	err := fsWalker(dir, false, func(path string, d os.DirEntry) {
+	err := fsWalker(dir, walkOptions{}, func(path string, d os.DirEntry) {
 		paths = append(paths, path)
 	})
 	if err != nil {
@@ -131,7 +131,7 @@ func TestFsWalkerIgnoreHidden(t *testing.T) {
 	}
 
 	var visited []string
-	err := fsWalker(dir, true, func(path string, d os.DirEntry) {
+	err := fsWalker(dir, walkOptions{ignoreHidden: true}, func(path string, d os.DirEntry) {
 		visited = append(visited, d.Name())
 	})
 	if err != nil {
@@ -170,7 +170,7 @@ func TestFsWalkerIgnoreHiddenDotfiles(t *testing.T) {
 	}
 
 	var visited []string
-	err := fsWalker(dir, true, func(path string, d os.DirEntry) {
+	err := fsWalker(dir, walkOptions{ignoreHidden: true}, func(path string, d os.DirEntry) {
 		visited = append(visited, d.Name())
 	})
 	if err != nil {
@@ -193,7 +193,7 @@ func TestFsWalkerIgnoreHiddenSingleFile(t *testing.T) {
 	}
 
 	var visited []string
-	err := fsWalker(hiddenFile, true, func(path string, d os.DirEntry) {
+	err := fsWalker(hiddenFile, walkOptions{ignoreHidden: true}, func(path string, d os.DirEntry) {
 		visited = append(visited, d.Name())
 	})
 	if err != nil {
@@ -214,7 +214,7 @@ func TestFsWalkerIncludeHidden(t *testing.T) {
 	}
 
 	var visited []string
-	err := fsWalker(dir, false, func(path string, d os.DirEntry) {
+	err := fsWalker(dir, walkOptions{}, func(path string, d os.DirEntry) {
 		visited = append(visited, d.Name())
 	})
 	if err != nil {
@@ -0,0 +1,311 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+)
+
+// Actions that can be taken on a file with matching findings.
+const (
+	actionMove   = "move"
+	actionDelete = "delete"
+	actionRename = "rename"
+	actionChmod  = "strip-permissions"
+)
+
+const (
+	defaultRenameSuffix = ".quarantined"
+	sidecarSuffix       = ".scanii.json"
+)
+
+// actionRecord is one line of the action log.
+type actionRecord struct {
+	Time        time.Time `json:"time"`
+	Action      string    `json:"action"`
+	Path        string    `json:"path"`
+	Destination string    `json:"destination,omitempty"`
+	Findings    []string  `json:"findings"`
+	DryRun      bool      `json:"dry_run,omitempty"`
+	Error       string    `json:"error,omitempty"`
+}
+
+// sidecar is written next to a quarantined file describing why it was moved.
+type sidecar struct {
+	OriginalPath  string       `json:"original_path"`
+	QuarantinedAt time.Time    `json:"quarantined_at"`
+	Result        resultOutput `json:"result"`
+}
+
+// remediation acts on files whose findings match a pattern once their
+// result is in: moving them into a quarantine directory, deleting,
+// renaming or making them unreadable. Patterns use path.Match syntax like
+// the policy flags. It is safe for concurrent use.
+type remediation struct {
+	action  string
+	on      []string
+	dir     string
+	suffix  string
+	dryRun  bool
+	logPath string
+
+	// root is what quarantined paths are made relative to
+	root string
+
+	mu      sync.Mutex
+	log     *os.File
+	records []actionRecord
+}
+
+func (m *remediation) enabled() bool {
+	return m.action != ""
+}
+
+// validate checks the action and its settings before any file is uploaded.
+func (m *remediation) validate() error {
+	switch m.action {
+	case actionMove:
+		if m.dir == "" {
+			return fmt.Errorf("--action %s requires --quarantine-dir", actionMove)
+		}
+	case actionRename:
+		if m.suffix == "" {
+			return fmt.Errorf("--action %s requires a non empty --rename-suffix", actionRename)
+		}
+	case actionDelete, actionChmod:
+	default:
+		return fmt.Errorf("invalid action %q, expected one of %s, %s, %s or %s", m.action, actionMove, actionDelete, actionRename, actionChmod)
+	}
+	if len(m.on) == 0 {
+		return fmt.Errorf("--action requires at least one --action-on pattern")
+	}
+	for _, pattern := range m.on {
+		if err := validatePattern(pattern); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// open prepares the action log, root is the directory being scanned.
+func (m *remediation) open(root string) error {
+	m.root = root
+	if m.logPath == "" {
+		return nil
+	}
+	fd, err := os.OpenFile(m.logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open action log: %w", err)
+	}
+	m.log = fd
+	return nil
+}
+
+func (m *remediation) close() error {
+	if m.log == nil {
+		return nil
+	}
+	return m.log.Close()
+}
+
+// exclusions returns exclude patterns for files this action already handled:
+// the quarantine directory when it is inside root and renamed files, so they
+// are not picked up again by the same walk or a later one.
+func (m *remediation) exclusions(root string) []string {
+	escape := strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`).Replace
+	switch m.action {
+	case actionRename:
+		return []string{"*" + escape(m.suffix)}
+	case actionMove:
+		absRoot, err := filepath.Abs(root)
+		if err != nil {
+			return nil
+		}
+		absDir, err := filepath.Abs(m.dir)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(absRoot, absDir)
+		if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return nil
+		}
+		return []string{"/" + escape(filepath.ToSlash(rel)) + "/"}
+	}
+	return nil
+}
+
+// matches returns the findings that trigger the action.
+func (m *remediation) matches(findings []string) []string {
+	var matched []string
+	for _, f := range findings {
+		if matchesAny(m.on, f) {
+			matched = append(matched, f)
+		}
+	}
+	return matched
+}
+
+// apply runs the action on the file behind r when its findings match.
+func (m *remediation) apply(r *resultRecord) {
+	if r.err != nil {
+		return
+	}
+	findings := m.matches(r.findings)
+	if len(findings) == 0 {
+		return
+	}
+
+	rec := actionRecord{Time: time.Now().UTC(), Action: m.action, Path: r.path, Findings: findings, DryRun: m.dryRun}
+	if r.streamed || r.staged {
+		// the path of streamed content is its --filename, which may well
+		// name an unrelated file in the working directory, and staged
+		// content may differ from the working tree copy
+		rec.Error = "not a file on disk"
+	} else if info, err := os.Lstat(r.path); err != nil || !info.Mode().IsRegular() {
+		// archive members have no file to act on
+		rec.Error = "not a file on disk"
+	} else if err := m.run(r, &rec); err != nil {
+		rec.Error = err.Error()
+	}
+	m.record(rec)
+}
+
+func (m *remediation) run(r *resultRecord, rec *actionRecord) error {
+	switch m.action {
+	case actionMove:
+		rel, err := filepath.Rel(m.root, r.path)
+		if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			rel = filepath.Base(r.path)
+		}
+		rec.Destination = filepath.Join(m.dir, rel)
+		if m.dryRun {
+			return nil
+		}
+		return quarantine(r, rec.Destination)
+	case actionDelete:
+		if m.dryRun {
+			return nil
+		}
+		return os.Remove(r.path)
+	case actionRename:
+		rec.Destination = r.path + m.suffix
+		if m.dryRun {
+			return nil
+		}
+		return os.Rename(r.path, rec.Destination)
+	case actionChmod:
+		if m.dryRun {
+			return nil
+		}
+		return os.Chmod(r.path, 0)
+	}
+	return nil
+}
+
+// quarantine moves a file to dest and writes its sidecar next to it.
+func quarantine(r *resultRecord, dest string) error {
+	if err := os.MkdirAll(filepath.Dir(dest), 0700); err != nil {
+		return err
+	}
+	if _, err := os.Lstat(dest); err == nil {
+		return fmt.Errorf("%s already exists", dest)
+	}
+	if err := moveFile(r.path, dest); err != nil {
+		return err
+	}
+
+	original, err := filepath.Abs(r.path)
+	if err != nil {
+		original = r.path
+	}
+	data, err := json.MarshalIndent(sidecar{OriginalPath: original, QuarantinedAt: time.Now().UTC(), Result: newResultOutput(r)}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(dest+sidecarSuffix, data, 0600)
+}
+
+// moveFile renames src to dest, copying when they are on different devices.
+func moveFile(src, dest string) error {
+	err := os.Rename(src, dest)
+	if err == nil {
+		return nil
+	}
+	if cerr := copyFile(src, dest); cerr != nil {
+		_ = os.Remove(dest)
+		return err
+	}
+	return os.Remove(src)
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_WRONLY|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		_ = out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (m *remediation) record(rec actionRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, rec)
+	if m.log == nil {
+		return
+	}
+	data, err := json.Marshal(rec)
+	if err == nil {
+		_, err = m.log.Write(append(data, '\n'))
+	}
+	if err != nil {
+		terminal.Warn(fmt.Sprintf("Failed to write action log: %s", err))
+	}
+}
+
+// report prints every action taken, or that would have been taken.
+func (m *remediation) report() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if len(m.records) == 0 {
+		return
+	}
+
+	title := "Actions"
+	if m.dryRun {
+		title = "Actions (dry run)"
+	}
+	terminal.Section(title)
+	for _, rec := range m.records {
+		target := rec.Path
+		if rec.Destination != "" {
+			target = fmt.Sprintf("%s → %s", rec.Path, rec.Destination)
+		}
+		if rec.Error != "" {
+			terminal.Error(fmt.Sprintf("%s %s: %s", rec.Action, target, rec.Error))
+			continue
+		}
+		terminal.Warn(fmt.Sprintf("%s %s", rec.Action, target))
+	}
+}
@@ -0,0 +1,291 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"testing"
+)
+
+const malicious = "content.malicious.eicar-test-signature"
+
+func writeTestFile(t *testing.T, path string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+	if err := os.WriteFile(path, []byte("bad"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+}
+
+func exists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
+
+func TestRemediationValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		m    *remediation
+		ok   bool
+	}{
+		{"move", &remediation{action: actionMove, dir: "q", on: []string{"content.malicious.*"}}, true},
+		{"move without dir", &remediation{action: actionMove, on: []string{"content.malicious.*"}}, false},
+		{"rename without suffix", &remediation{action: actionRename, on: []string{"*"}}, false},
+		{"delete", &remediation{action: actionDelete, on: []string{"*"}}, true},
+		{"unknown action", &remediation{action: "shred", on: []string{"*"}}, false},
+		{"no patterns", &remediation{action: actionChmod}, false},
+		{"bad pattern", &remediation{action: actionDelete, on: []string{"[a"}}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.validate()
+			if (err == nil) != tt.ok {
+				t.Errorf("validate() = %v, expected ok=%v", err, tt.ok)
+			}
+		})
+	}
+}
+
+func TestRemediationMove(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "quarantine")
+	path := filepath.Join(root, "sub", "bad.exe")
+	writeTestFile(t, path)
+
+	logPath := filepath.Join(t.TempDir(), "actions.log")
+	m := &remediation{action: actionMove, dir: dir, on: []string{"content.malicious.*"}, logPath: logPath}
+	if err := m.open(root); err != nil {
+		t.Fatalf("open: %s", err)
+	}
+	m.apply(&resultRecord{path: path, id: "1", findings: []string{malicious, "content.en.language.nsfw.0"}})
+	if err := m.close(); err != nil {
+		t.Fatalf("close: %s", err)
+	}
+
+	dest := filepath.Join(dir, "sub", "bad.exe")
+	if exists(path) || !exists(dest) {
+		t.Fatalf("expected %s to be moved to %s", path, dest)
+	}
+
+	data, err := os.ReadFile(dest + sidecarSuffix)
+	if err != nil {
+		t.Fatalf("sidecar: %s", err)
+	}
+	var s sidecar
+	if err := json.Unmarshal(data, &s); err != nil {
+		t.Fatalf("unmarshal sidecar: %s", err)
+	}
+	if s.OriginalPath != path || s.Result.ID != "1" {
+		t.Errorf("unexpected sidecar %+v", s)
+	}
+
+	fd, err := os.Open(logPath)
+	if err != nil {
+		t.Fatalf("log: %s", err)
+	}
+	defer func() { _ = fd.Close() }()
+	scanner := bufio.NewScanner(fd)
+	var lines []actionRecord
+	for scanner.Scan() {
+		var rec actionRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			t.Fatalf("unmarshal log line: %s", err)
+		}
+		lines = append(lines, rec)
+	}
+	if len(lines) != 1 || lines[0].Destination != dest || len(lines[0].Findings) != 1 || lines[0].Error != "" {
+		t.Errorf("unexpected action log %+v", lines)
+	}
+}
+
+func TestRemediationMoveRefusesOverwrite(t *testing.T) {
+	root := t.TempDir()
+	dir := t.TempDir()
+	path := filepath.Join(root, "bad.exe")
+	writeTestFile(t, path)
+	writeTestFile(t, filepath.Join(dir, "bad.exe"))
+
+	m := &remediation{action: actionMove, dir: dir, on: []string{"*"}}
+	_ = m.open(root)
+	m.apply(&resultRecord{path: path, findings: []string{malicious}})
+
+	if !exists(path) {
+		t.Error("expected the file to stay in place")
+	}
+	if len(m.records) != 1 || m.records[0].Error == "" {
+		t.Errorf("expected a failed action, got %+v", m.records)
+	}
+}
+
+func TestRemediationActions(t *testing.T) {
+	tests := []struct {
+		action string
+		check  func(t *testing.T, path string)
+	}{
+		{actionDelete, func(t *testing.T, path string) {
+			if exists(path) {
+				t.Error("expected the file to be deleted")
+			}
+		}},
+		{actionRename, func(t *testing.T, path string) {
+			if exists(path) || !exists(path+defaultRenameSuffix) {
+				t.Error("expected the file to be renamed")
+			}
+		}},
+		{actionChmod, func(t *testing.T, path string) {
+			if runtime.GOOS == "windows" {
+				t.Skip("windows only has a read-only attribute")
+			}
+			info, err := os.Stat(path)
+			if err != nil {
+				t.Fatalf("stat: %s", err)
+			}
+			if info.Mode().Perm() != 0 {
+				t.Errorf("expected no permissions, got %s", info.Mode().Perm())
+			}
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			root := t.TempDir()
+			path := filepath.Join(root, "bad.exe")
+			writeTestFile(t, path)
+
+			m := &remediation{action: tt.action, suffix: defaultRenameSuffix, on: []string{"content.malicious.*"}}
+			_ = m.open(root)
+			m.apply(&resultRecord{path: path, findings: []string{malicious}})
+			if len(m.records) != 1 || m.records[0].Error != "" {
+				t.Fatalf("unexpected records %+v", m.records)
+			}
+			tt.check(t, path)
+		})
+	}
+}
+
+func TestRemediationSkips(t *testing.T) {
+	root := t.TempDir()
+	path := filepath.Join(root, "file.txt")
+	writeTestFile(t, path)
+
+	m := &remediation{action: actionDelete, on: []string{"content.malicious.*"}}
+	_ = m.open(root)
+	m.apply(&resultRecord{path: path, findings: []string{"content.en.language.nsfw.0"}})
+	m.apply(&resultRecord{path: path, err: errors.New("boom")})
+	if !exists(path) || len(m.records) != 0 {
+		t.Fatalf("expected non matching and failed results to be left alone, got %+v", m.records)
+	}
+
+	m.apply(&resultRecord{path: memberPath(filepath.Join(root, "a.zip"), "bad.exe"), findings: []string{malicious}})
+	if len(m.records) != 1 || m.records[0].Error == "" {
+		t.Errorf("expected archive members to be reported as not on disk, got %+v", m.records)
+	}
+}
+
+func TestRemediationSkipsStreamed(t *testing.T) {
+	contents, err := os.ReadFile(fakeMalwareSample)
+	if err != nil {
+		t.Fatalf("read sample: %s", err)
+	}
+	svc := newTestService(t)
+	svc.stdin = bytes.NewReader(contents)
+	svc.stdinName = "bad.exe"
+
+	// an unrelated file named as the --filename of the streamed content
+	t.Chdir(t.TempDir())
+	writeTestFile(t, "bad.exe")
+
+	r := processOne(t, svc, stdinPath)
+	if r.err != nil || len(r.findings) == 0 {
+		t.Fatalf("expected findings, got %+v", r)
+	}
+	m := &remediation{action: actionDelete, on: []string{"*"}}
+	_ = m.open(".")
+	m.apply(&r)
+	if !exists("bad.exe") {
+		t.Fatal("expected the file in the working directory to be left alone")
+	}
+	if len(m.records) != 1 || m.records[0].Error == "" {
+		t.Errorf("expected streamed content to be reported as not on disk, got %+v", m.records)
+	}
+}
+
+func TestRemediationSkipsStaged(t *testing.T) {
+	root, git := gitRepo(t, "bad.exe")
+	contents, err := os.ReadFile(fakeMalwareSample)
+	if err != nil {
+		t.Fatalf("read sample: %s", err)
+	}
+	// the malware is staged, the working tree holds an edited copy
+	path := filepath.Join(root, "bad.exe")
+	if err := os.WriteFile(path, contents, 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	git("add", "bad.exe")
+	if err := os.WriteFile(path, []byte("edited"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	svc := newTestService(t)
+	if svc.index, err = (gitSelection{staged: true}).index(root); err != nil {
+		t.Fatalf("index: %s", err)
+	}
+	r := processOne(t, svc, path)
+	if r.err != nil || len(r.findings) == 0 {
+		t.Fatalf("expected findings, got %+v", r)
+	}
+	m := &remediation{action: actionDelete, on: []string{"*"}}
+	_ = m.open(root)
+	m.apply(&r)
+	if !exists(path) {
+		t.Fatal("expected the working tree copy to be left alone")
+	}
+	if len(m.records) != 1 || m.records[0].Error == "" {
+		t.Errorf("expected staged content to be reported as not on disk, got %+v", m.records)
+	}
+}
+
+func TestRemediationDryRun(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(t.TempDir(), "quarantine")
+	path := filepath.Join(root, "bad.exe")
+	writeTestFile(t, path)
+
+	m := &remediation{action: actionMove, dir: dir, on: []string{"*"}, dryRun: true}
+	_ = m.open(root)
+	m.apply(&resultRecord{path: path, findings: []string{malicious}})
+
+	if !exists(path) || exists(dir) {
+		t.Error("expected dry run to leave the file in place")
+	}
+	if len(m.records) != 1 || !m.records[0].DryRun || m.records[0].Destination != filepath.Join(dir, "bad.exe") {
+		t.Errorf("unexpected records %+v", m.records)
+	}
+}
+
+func TestRemediationExclusions(t *testing.T) {
+	root := t.TempDir()
+	tests := []struct {
+		m        *remediation
+		expected []string
+	}{
+		{&remediation{action: actionMove, dir: filepath.Join(root, "quarantine")}, []string{"/quarantine/"}},
+		{&remediation{action: actionMove, dir: filepath.Join(root, "a", "q[1]")}, []string{`/a/q\[1]/`}},
+		{&remediation{action: actionMove, dir: root}, nil},
+		{&remediation{action: actionMove, dir: t.TempDir()}, nil},
+		{&remediation{action: actionRename, suffix: ".bad*"}, []string{`*.bad\*`}},
+		{&remediation{action: actionDelete}, nil},
+	}
+	for _, tt := range tests {
+		patterns := tt.m.exclusions(root)
+		if !slices.Equal(patterns, tt.expected) {
+			t.Errorf("exclusions(%s %s) = %q, expected %q", tt.m.action, tt.m.dir, patterns, tt.expected)
+		}
+	}
+}
@@ -14,15 +14,27 @@ import (
 	"github.com/uvasoftware/scanii-cli/internal/terminal"
 )
 
-func retrieveCommand(ctx context.Context, profileName *string) *cobra.Command {
+func retrieveCommand(ctx context.Context, profileName, outputFormat *string) *cobra.Command {
 	var wait int
+	var fromFile string
+	concurrency := defaultLookupConcurrency
 
 	cmd := &cobra.Command{
-		Use:        "retrieve [flags] [id]",
-		Short:      "Retrieve a previously created processing result",
-		Args:       cobra.ExactArgs(1),
+		Use:   "retrieve [flags] [id...]",
+		Short: "Retrieve previously created processing results",
+		Long: `Retrieve previously created processing results.
+
+Several ids may be given, or read with --from-file from a list with one id per
+line or from the json or ndjson output of a prior run. They are retrieved
+concurrently and reported with a status of complete, pending, not found or
+error.`,
+		Args:       cobra.ArbitraryArgs,
 		ArgAliases: []string{"id"},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := openOutput(*outputFormat)
+			if err != nil {
+				return err
+			}
 
 			profile, err := profile2.Load(*profileName)
 			if err != nil {
@@ -33,12 +45,32 @@ func retrieveCommand(ctx context.Context, profileName *string) *cobra.Command {
 				return err
 			}
 
-			_, err = callFileRetrieve(ctx, c, args[0], wait)
-			return err
+			if len(args) != 1 || fromFile != "" {
+				refs, err := collectIDs(args, fromFile)
+				if err != nil {
+					return err
+				}
+				return retrieveAll(ctx, c, refs, lookupOptions{
+					concurrency: concurrency,
+					wait:        time.Duration(wait) * time.Second,
+					output:      out,
+				})
+			}
+
+			result, err := callFileRetrieve(ctx, c, args[0], wait)
+			if err != nil {
+				return err
+			}
+			if err := out.result(result); err != nil {
+				return err
+			}
+			return out.close()
 		},
 	}
 
 	cmd.PersistentFlags().IntVarP(&wait, "wait", "w", 0, "Seconds to poll for the result before giving up")
+	cmd.PersistentFlags().StringVarP(&fromFile, "from-file", "f", "", "Retrieve every id listed in this file, - reads the list from standard input")
+	cmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", concurrency, "Number of ids retrieved concurrently")
 
 	return cmd
 }
@@ -76,32 +108,7 @@ func callFileRetrieve(ctx context.Context, c *client.Client, s string, wait int)
 			}
 			// continue polling if wait > 0 and we got a non-200 response
 		} else {
-			pr := resp.Result
-
-			result := resultRecord{
-				id: *pr.ID,
-			}
-			if pr.Metadata != nil {
-				result.metadata = *pr.Metadata
-			}
-			if pr.ContentType != nil {
-				result.contentType = *pr.ContentType
-			}
-			if pr.Checksum != nil {
-				result.checksum = *pr.Checksum
-			}
-			if pr.Findings != nil {
-				result.findings = *pr.Findings
-			}
-			if pr.ContentLength != nil {
-				result.contentLength = uint64(*pr.ContentLength)
-			}
-			if pr.CreationDate != nil {
-				result.creationDate = *pr.CreationDate
-			}
-			if pr.Error != nil {
-				result.err = fmt.Errorf("error retrieving file with id %s: %s", s, *pr.Error)
-			}
+			result := processingRecord(resp.Result)
 
 			// If result has a checksum, processing is complete
 			if result.checksum != "" || result.err != nil {
@@ -109,13 +116,11 @@ func callFileRetrieve(ctx context.Context, c *client.Client, s string, wait int)
 					spinner.Stop()
 				}
 				terminal.Success(fmt.Sprintf("Result found in %s", terminal.FormatDuration(time.Since(startTime))))
-				printFileResult(&result)
 				return &result, nil
 			}
 
 			// Processing not complete yet — if not waiting, return what we have
 			if wait == 0 {
-				printFileResult(&result)
 				return &result, nil
 			}
 		}
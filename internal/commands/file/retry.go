@@ -0,0 +1,115 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"syscall"
+	"time"
+)
+
+// Defaults for retrying transient upload failures.
+const (
+	defaultRetries       = 3
+	defaultRetryDelay    = 500 * time.Millisecond
+	defaultRetryMaxDelay = 30 * time.Second
+)
+
+// retryPolicy decides how often and how long to wait before uploading a
+// file again after a transient failure. The zero value never retries.
+type retryPolicy struct {
+	// retries is how many times a file is retried after the first attempt
+	retries  int
+	delay    time.Duration
+	maxDelay time.Duration
+}
+
+func defaultRetryPolicy() retryPolicy {
+	return retryPolicy{retries: defaultRetries, delay: defaultRetryDelay, maxDelay: defaultRetryMaxDelay}
+}
+
+// transient describes an attempt that failed in a way worth retrying.
+type transient struct {
+	// retryAfter is the wait requested by the server, zero when it gave none
+	retryAfter time.Duration
+}
+
+// retryableStatus reports whether a response status is worth retrying.
+func retryableStatus(status int) bool {
+	return status == http.StatusTooManyRequests || status >= 500
+}
+
+// retryableError reports whether a transport error is worth retrying, as
+// when the connection was refused or dropped. Anything else, such as a
+// response that could not be decoded after the file was accepted, is final
+// so the file is not uploaded twice.
+func retryableError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	// every *url.Error is a net.Error, what matters is the error it wraps
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// parseRetryAfter reads a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(header http.Header) time.Duration {
+	v := header.Get("Retry-After")
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs > 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if at, err := http.ParseTime(v); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// backoff returns how long to wait before the given retry, starting at 1.
+// The delay doubles with each retry up to maxDelay, half of it jittered so
+// workers that failed together do not retry together. A Retry-After from the
+// server is honored when it asks for longer.
+func (p retryPolicy) backoff(retry int, t *transient) time.Duration {
+	d := p.delay
+	for i := 1; i < retry && d < p.maxDelay; i++ {
+		d *= 2
+	}
+	if p.maxDelay > 0 && d > p.maxDelay {
+		d = p.maxDelay
+	}
+	if d > 0 {
+		d = d/2 + rand.N(d/2+1) //nolint:gosec
+	}
+	if t != nil && t.retryAfter > d {
+		d = t.retryAfter
+	}
+	return d
+}
+
+// wait sleeps for d, returning false if ctx is cancelled first.
+func wait(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
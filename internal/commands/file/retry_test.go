@@ -0,0 +1,160 @@
+package file
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	p := retryPolicy{retries: 5, delay: 100 * time.Millisecond, maxDelay: time.Second}
+	for retry, ceiling := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 6: time.Second} {
+		for range 20 {
+			if d := p.backoff(retry, nil); d < ceiling/2 || d > ceiling {
+				t.Fatalf("retry %d: delay %s outside [%s, %s]", retry, d, ceiling/2, ceiling)
+			}
+		}
+	}
+	if d := p.backoff(1, &transient{retryAfter: 5 * time.Second}); d != 5*time.Second {
+		t.Errorf("expected Retry-After to be honored, got %s", d)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	h := http.Header{}
+	if d := parseRetryAfter(h); d != 0 {
+		t.Errorf("expected no delay, got %s", d)
+	}
+	h.Set("Retry-After", "3")
+	if d := parseRetryAfter(h); d != 3*time.Second {
+		t.Errorf("expected 3s, got %s", d)
+	}
+	h.Set("Retry-After", time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if d := parseRetryAfter(h); d < 58*time.Second || d > time.Minute {
+		t.Errorf("expected about a minute, got %s", d)
+	}
+}
+
+// flakyService returns a service whose uploads fail with status for the
+// first failures attempts and then reach the mock server.
+func flakyService(t *testing.T, failures int32, status int) (*service, *atomic.Int32) {
+	t.Helper()
+	upstream, _ := url.Parse("http://" + ts.Endpoint)
+	proxy := httputil.NewSingleHostReverseProxy(upstream)
+	attempts := &atomic.Int32{}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/files") && attempts.Add(1) <= failures {
+			_, _ = io.Copy(io.Discard, r.Body)
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(status)
+			return
+		}
+		proxy.ServeHTTP(w, r)
+	}))
+	t.Cleanup(srv.Close)
+
+	p := *ts.Profile
+	p.Endpoint = "localhost:" + srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	svc, err := newService(&p)
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	svc.retry = retryPolicy{retries: 2, delay: time.Millisecond, maxDelay: 5 * time.Millisecond}
+	return svc, attempts
+}
+
+func TestServiceProcessRetriesTransientFailures(t *testing.T) {
+	svc, attempts := flakyService(t, 2, http.StatusServiceUnavailable)
+
+	r := processOne(t, svc, fakeMalwareSample)
+	if r.err != nil {
+		t.Fatalf("expected the third attempt to succeed, got %s", r.err)
+	}
+	if r.retries != 2 || attempts.Load() != 3 {
+		t.Errorf("expected 2 retries over 3 attempts, got %d and %d", r.retries, attempts.Load())
+	}
+	checkResponseContent(t, &r)
+}
+
+func TestServiceProcessGivesUpAfterRetries(t *testing.T) {
+	svc, attempts := flakyService(t, 10, http.StatusTooManyRequests)
+
+	r := processOne(t, svc, fakeMalwareSample)
+	if r.err == nil || !strings.Contains(r.err.Error(), "429") {
+		t.Fatalf("expected a 429 error, got %v", r.err)
+	}
+	if r.retries != 2 || attempts.Load() != 3 {
+		t.Errorf("expected 2 retries over 3 attempts, got %d and %d", r.retries, attempts.Load())
+	}
+}
+
+func TestServiceProcessDoesNotRetryClientErrors(t *testing.T) {
+	svc, attempts := flakyService(t, 10, http.StatusBadRequest)
+
+	r := processOne(t, svc, fakeMalwareSample)
+	if r.err == nil || r.retries != 0 || attempts.Load() != 1 {
+		t.Errorf("expected a single failed attempt, got %v after %d attempt(s)", r.err, attempts.Load())
+	}
+}
+
+func TestServiceProcessRetriesNetworkErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	closed := "localhost:" + srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	srv.Close()
+
+	p := *ts.Profile
+	p.Endpoint = closed
+	svc, err := newService(&p)
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	svc.retry = retryPolicy{retries: 2, delay: time.Millisecond, maxDelay: 5 * time.Millisecond}
+
+	r := processOne(t, svc, fakeMalwareSample)
+	if r.err == nil || r.retries != 2 {
+		t.Errorf("expected a connection error after 2 retries, got %v after %d", r.err, r.retries)
+	}
+}
+
+func TestServiceProcessDoesNotRetryDecodeErrors(t *testing.T) {
+	attempts := &atomic.Int32{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the file was accepted, retrying would upload it again
+		attempts.Add(1)
+		_, _ = io.Copy(io.Discard, r.Body)
+		w.WriteHeader(http.StatusCreated)
+		_, _ = io.WriteString(w, "not json")
+	}))
+	t.Cleanup(srv.Close)
+
+	p := *ts.Profile
+	p.Endpoint = "localhost:" + srv.URL[strings.LastIndex(srv.URL, ":")+1:]
+	svc, err := newService(&p)
+	if err != nil {
+		t.Fatalf("failed to create service: %s", err)
+	}
+	svc.retry = retryPolicy{retries: 2, delay: time.Millisecond, maxDelay: 5 * time.Millisecond}
+
+	r := processOne(t, svc, fakeMalwareSample)
+	if r.err == nil || r.retries != 0 || attempts.Load() != 1 {
+		t.Errorf("expected a single failed attempt, got %v after %d attempt(s)", r.err, attempts.Load())
+	}
+}
+
+func TestServiceProcessDoesNotRetryStdin(t *testing.T) {
+	svc, attempts := flakyService(t, 10, http.StatusServiceUnavailable)
+	svc.stdin = strings.NewReader("streamed content")
+	svc.stdinName = defaultStdinName
+
+	r := processOne(t, svc, stdinPath)
+	if r.err == nil || r.retries != 0 || attempts.Load() != 1 {
+		t.Errorf("expected a single failed attempt, got %v after %d attempt(s)", r.err, attempts.Load())
+	}
+}
@@ -0,0 +1,228 @@
+package file
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	sarifSchema  = "https://json.schemastore.org/sarif-2.1.0.json"
+	sarifVersion = "2.1.0"
+	// sarifRoot is the uriBaseId results are located relative to.
+	sarifRoot = "SRCROOT"
+)
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool               sarifTool                   `json:"tool"`
+	OriginalURIBaseIDs map[string]sarifArtifactURI `json:"originalUriBaseIds,omitempty"`
+	Results            []sarifResult               `json:"results"`
+	Invocations        []sarifInvocation           `json:"invocations"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string        `json:"id"`
+	ShortDescription sarifMessage  `json:"shortDescription"`
+	DefaultConfig    sarifRuleConf `json:"defaultConfiguration"`
+}
+
+type sarifRuleConf struct {
+	Level string `json:"level"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifArtifactURI struct {
+	URI       string `json:"uri"`
+	URIBaseID string `json:"uriBaseId,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactURI `json:"artifactLocation"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	RuleIndex           int               `json:"ruleIndex"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations"`
+	PartialFingerprints map[string]string `json:"partialFingerprints,omitempty"`
+	Properties          map[string]string `json:"properties,omitempty"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifNotification struct {
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+// sarifLevel maps a finding to a SARIF level, malicious content is an
+// error while everything else, such as language or nudity, is a warning.
+func sarifLevel(finding string) string {
+	if strings.HasPrefix(finding, "content.malicious.") {
+		return "error"
+	}
+	return "warning"
+}
+
+// relativePath returns path relative to root and forward slash separated,
+// falling back to the cleaned path when it is outside root.
+func relativePath(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		rel = path
+	}
+	return filepath.ToSlash(rel)
+}
+
+// relativeURI returns relativePath as a URI reference.
+func relativeURI(root, path string) string {
+	return (&url.URL{Path: relativePath(root, path)}).String()
+}
+
+// writeSARIF renders records as a SARIF 2.1 log. Every finding on a file
+// becomes a result located at the file's path relative to root and each
+// distinct finding becomes a rule; files that could not be processed are
+// reported as tool execution notifications.
+func writeSARIF(w io.Writer, root string, records []resultRecord) error {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return err
+	}
+
+	ruleIndex := map[string]int{}
+	for _, r := range records {
+		for _, f := range r.findings {
+			ruleIndex[f] = 0
+		}
+	}
+	ruleIDs := make([]string, 0, len(ruleIndex))
+	for id := range ruleIndex {
+		ruleIDs = append(ruleIDs, id)
+	}
+	sort.Strings(ruleIDs)
+
+	rules := make([]sarifRule, 0, len(ruleIDs))
+	for i, id := range ruleIDs {
+		ruleIndex[id] = i
+		rules = append(rules, sarifRule{
+			ID:               id,
+			ShortDescription: sarifMessage{Text: fmt.Sprintf("Content matched %s", id)},
+			DefaultConfig:    sarifRuleConf{Level: sarifLevel(id)},
+		})
+	}
+
+	// results are sorted by path so reports are stable across runs
+	sorted := make([]resultRecord, len(records))
+	copy(sorted, records)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].path < sorted[j].path })
+
+	results := []sarifResult{}
+	invocation := sarifInvocation{ExecutionSuccessful: true}
+	for _, r := range sorted {
+		location := []sarifLocation{{PhysicalLocation: sarifPhysicalLocation{
+			ArtifactLocation: sarifArtifactURI{URI: relativeURI(absRoot, absPath(r.path)), URIBaseID: sarifRoot},
+		}}}
+
+		if r.err != nil {
+			invocation.ExecutionSuccessful = false
+			invocation.ToolExecutionNotifications = append(invocation.ToolExecutionNotifications, sarifNotification{
+				Level:     "error",
+				Message:   sarifMessage{Text: r.err.Error()},
+				Locations: location,
+			})
+			continue
+		}
+
+		for _, f := range r.findings {
+			result := sarifResult{
+				RuleID:    f,
+				RuleIndex: ruleIndex[f],
+				Level:     sarifLevel(f),
+				Message:   sarifMessage{Text: fmt.Sprintf("%s: %s", relativeURI(absRoot, absPath(r.path)), f)},
+				Locations: location,
+				Properties: map[string]string{
+					"id": r.id,
+				},
+			}
+			if r.checksum != "" {
+				result.PartialFingerprints = map[string]string{"sha1/v1": r.checksum}
+			}
+			results = append(results, result)
+		}
+	}
+
+	log := sarifLog{
+		Schema:  sarifSchema,
+		Version: sarifVersion,
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "sc",
+				InformationURI: "https://github.com/uvasoftware/scanii-cli",
+				Rules:          rules,
+			}},
+			OriginalURIBaseIDs: map[string]sarifArtifactURI{
+				sarifRoot: {URI: fileURI(absRoot)},
+			},
+			Results:     results,
+			Invocations: []sarifInvocation{invocation},
+		}},
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(log)
+}
+
+// fileURI returns the file:// URI of an absolute directory, with the
+// trailing slash SARIF requires of base URIs.
+func fileURI(dir string) string {
+	p := filepath.ToSlash(dir)
+	if !strings.HasPrefix(p, "/") {
+		p = "/" + p
+	}
+	if !strings.HasSuffix(p, "/") {
+		p += "/"
+	}
+	return (&url.URL{Scheme: "file", Path: p}).String()
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
@@ -0,0 +1,97 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWriteSARIF(t *testing.T) {
+	root := t.TempDir()
+	records := []resultRecord{
+		{path: filepath.Join(root, "sub", "eicar.txt"), id: "a", checksum: "3395856ce81f2b7382dee72602f798b642f14140", findings: []string{"content.malicious.eicar-test-signature", "content.en.language.nsfw.0"}},
+		{path: filepath.Join(root, "clean.txt"), id: "b"},
+		{path: filepath.Join(root, "other.txt"), id: "c", findings: []string{"content.malicious.eicar-test-signature"}},
+		{path: filepath.Join(root, "locked.txt"), err: errors.New("permission denied")},
+	}
+
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, root, records); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+
+	var log sarifLog
+	if err := json.Unmarshal(buf.Bytes(), &log); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if log.Version != "2.1.0" || len(log.Runs) != 1 {
+		t.Fatalf("unexpected log: %+v", log)
+	}
+	run := log.Runs[0]
+
+	rules := run.Tool.Driver.Rules
+	if len(rules) != 2 || rules[0].ID != "content.en.language.nsfw.0" || rules[1].ID != "content.malicious.eicar-test-signature" {
+		t.Fatalf("unexpected rules: %+v", rules)
+	}
+	if rules[1].DefaultConfig.Level != "error" || rules[0].DefaultConfig.Level != "warning" {
+		t.Errorf("unexpected rule levels: %+v", rules)
+	}
+
+	if len(run.Results) != 3 {
+		t.Fatalf("want 3 results, got %d", len(run.Results))
+	}
+	for _, r := range run.Results {
+		if rules[r.RuleIndex].ID != r.RuleID {
+			t.Errorf("rule index %d does not point at %s", r.RuleIndex, r.RuleID)
+		}
+		uri := r.Locations[0].PhysicalLocation.ArtifactLocation
+		if uri.URIBaseID != sarifRoot || strings.HasPrefix(uri.URI, "/") {
+			t.Errorf("expected a relative location, got %+v", uri)
+		}
+	}
+	if uri := run.Results[0].Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "other.txt" {
+		t.Errorf("results should be sorted by path, got %s first", uri)
+	}
+	if uri := run.Results[1].Locations[0].PhysicalLocation.ArtifactLocation.URI; uri != "sub/eicar.txt" {
+		t.Errorf("unexpected location %s", uri)
+	}
+
+	invocation := run.Invocations[0]
+	if invocation.ExecutionSuccessful {
+		t.Error("expected the invocation to be marked unsuccessful")
+	}
+	if len(invocation.ToolExecutionNotifications) != 1 || invocation.ToolExecutionNotifications[0].Message.Text != "permission denied" {
+		t.Errorf("unexpected notifications: %+v", invocation.ToolExecutionNotifications)
+	}
+	if base := run.OriginalURIBaseIDs[sarifRoot].URI; !strings.HasPrefix(base, "file:///") || !strings.HasSuffix(base, "/") {
+		t.Errorf("unexpected base uri %s", base)
+	}
+}
+
+func TestWriteSARIFNoFindings(t *testing.T) {
+	var buf bytes.Buffer
+	if err := writeSARIF(&buf, t.TempDir(), nil); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if !strings.Contains(buf.String(), `"results": []`) || !strings.Contains(buf.String(), `"rules": []`) {
+		t.Errorf("expected empty results and rules, got %s", buf.String())
+	}
+}
+
+func TestRelativeURI(t *testing.T) {
+	root := filepath.Join(string(filepath.Separator), "scan")
+	tests := map[string]string{
+		filepath.Join(root, "sub", "a b.txt"):                             "sub/a%20b.txt",
+		filepath.Join(root, "..foo"):                                      "..foo",
+		filepath.Join(root, "..", "outside.txt"):                          filepath.ToSlash(filepath.Join(string(filepath.Separator), "outside.txt")),
+		filepath.Join(string(filepath.Separator), "elsewhere", "..x.txt"): filepath.ToSlash(filepath.Join(string(filepath.Separator), "elsewhere", "..x.txt")),
+	}
+	for path, want := range tests {
+		if got := relativeURI(root, path); got != want {
+			t.Errorf("relativeURI(%s) = %s, expected %s", path, got, want)
+		}
+	}
+}
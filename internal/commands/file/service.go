@@ -3,6 +3,7 @@ package file
 import (
 	"context"
 	sha1hash "crypto/sha1" //nolint:gosec
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
@@ -10,14 +11,44 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"time"
 
 	"github.com/uvasoftware/scanii-cli/internal/client"
 	"github.com/uvasoftware/scanii-cli/internal/commands/profile"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/sync/errgroup"
 )
 
+var tracer = otel.Tracer("github.com/uvasoftware/scanii-cli/internal/commands/file")
+
 type service struct {
 	client *client.Client
+	// cache, when set, short-circuits synchronous uploads of unchanged files
+	cache *resultCache
+	// retry decides whether transient upload failures are tried again
+	retry retryPolicy
+	// requests and bandwidth, when set, pace uploads across all workers
+	requests  *limiter
+	bandwidth *limiter
+	// templates, when set, expands metadata values for each file
+	templates *metadataTemplates
+	// sources reads the paths that are not uploaded from the working tree
+	sources
+}
+
+// sources reads the content of paths that are not plain files in the
+// working tree: standard input, archive members and staged git content.
+type sources struct {
+	// stdin is read when the path is stdinPath and uploaded as stdinName
+	stdin     io.Reader
+	stdinName string
+	// archives, when set, holds archive members extracted for upload
+	archives *expander
+	// index, when set, holds the files uploaded as staged in git
+	index *gitIndex
 }
 
 func newService(profile *profile.Profile) (*service, error) {
@@ -41,16 +72,8 @@ func (s *service) retrieve(ctx context.Context, id string) (*resultRecord, error
 		return nil, nil
 	}
 
-	r := resp.Result
-	return &resultRecord{
-		id:            *r.ID,
-		contentType:   *r.ContentType,
-		checksum:      *r.Checksum,
-		findings:      *r.Findings,
-		contentLength: uint64(*r.ContentLength),
-		creationDate:  *r.CreationDate,
-		metadata:      *r.Metadata,
-	}, nil
+	r := processingRecord(resp.Result)
+	return &r, nil
 }
 
 // process is the main function that processes the files in the stream
@@ -62,190 +85,310 @@ func (s *service) process(ctx context.Context, stream chan string, maxConcurrenc
 
 	for path := range stream {
 		g.Go(func() error {
+			ctx, span := tracer.Start(ctx, "files.upload", trace.WithAttributes(
+				attribute.String("file.path", path),
+				attribute.Bool("async", async),
+			))
+			defer span.End()
+			started := time.Now()
+
+			// report records the outcome on the upload span before handing it off
+			report := func(r resultRecord) {
+				span.SetAttributes(
+					attribute.String("scanii.id", r.id),
+					attribute.Int64("content.length", int64(r.contentLength)), //nolint:gosec
+					attribute.Int("findings.count", len(r.findings)),
+					attribute.Bool("cache.hit", r.cached),
+					attribute.Int("retries", r.retries),
+				)
+				r.elapsed = time.Since(started)
+				if r.err != nil {
+					span.RecordError(r.err)
+					span.SetStatus(codes.Error, r.err.Error())
+				}
+				consumer(r)
+			}
 
-			r := resultRecord{path: path}
-
-			fd, err := os.Open(path)
+			metadata, err := s.expandMetadata(path, metadata)
 			if err != nil {
-				slog.Error("could not open file", "path", path, "error", err.Error())
-				r.err = err
-				consumer(r)
+				report(resultRecord{path: path, err: err})
 				return nil
 			}
 
-			type writerResult struct {
-				sha1 string
-				err  error
+			if s.cache != nil && !async && path != stdinPath && !s.index.lookup(path) {
+				if cached, ok := s.cache.lookup(path, metadata); ok {
+					slog.Debug("using cached result", "path", path)
+					report(cached)
+					return nil
+				}
 			}
 
-			pipeReader, pipeWriter := io.Pipe()
-			mpb := multipart.NewWriter(pipeWriter)
-			contentType := mpb.FormDataContentType()
-			writeDone := make(chan writerResult, 1)
-
-			go func() {
-				defer close(writeDone)
-				defer func() { _ = fd.Close() }()
-
-				sha1 := sha1hash.New() //nolint:gosec
-				fdAndShaReader := io.TeeReader(fd, sha1)
-
-				sendErr := func(prefix string, err error) {
-					_ = pipeWriter.CloseWithError(err)
-					writeDone <- writerResult{err: fmt.Errorf("%s: %w", prefix, err)}
+			// every attempt reopens the file and rebuilds the multipart body
+			for retry := 0; ; retry++ {
+				if err := s.requests.wait(ctx, 1); err != nil {
+					report(resultRecord{path: path, err: err, retries: retry})
+					return nil
 				}
-
-				filePartWriter, err := mpb.CreateFormFile("file", filepath.Base(path))
-				if err != nil {
-					sendErr("create form file", err)
-					return
+				r, t := s.upload(ctx, path, callback, async, metadata)
+				r.retries = retry
+				// standard input cannot be read a second time
+				if t == nil || retry >= s.retry.retries || path == stdinPath {
+					report(r)
+					return nil
 				}
 
-				if _, err = io.Copy(filePartWriter, fdAndShaReader); err != nil {
-					sendErr("copy file", err)
-					return
+				delay := s.retry.backoff(retry+1, t)
+				slog.Warn("retrying upload", "path", path, "error", r.err, "retry", retry+1, "delay", delay)
+				span.AddEvent("retry", trace.WithAttributes(attribute.Int("retry", retry+1), attribute.String("error", r.err.Error())))
+				if !wait(ctx, delay) {
+					report(r)
+					return nil
 				}
+			}
+		})
 
-				for k, v := range metadata {
-					if err = mpb.WriteField(fmt.Sprintf("metadata[%s]", k), v); err != nil {
-						sendErr("write metadata", err)
-						return
-					}
-				}
+	}
+	err := g.Wait()
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
-				if callback != "" {
-					if err = mpb.WriteField("callback", callback); err != nil {
-						sendErr("write callback", err)
-						return
-					}
-				}
+// open returns the content to upload for path along with the name of its
+// multipart part. Standard input, archive members and staged content have
+// no file info.
+func (s *sources) open(path string) (io.ReadCloser, os.FileInfo, string, error) {
+	if path == stdinPath {
+		if s.stdin == nil {
+			return nil, nil, "", fmt.Errorf("standard input is not available")
+		}
+		return io.NopCloser(s.stdin), nil, s.stdinName, nil
+	}
+	if file, member, ok := s.archives.lookup(path); ok {
+		// members are temporary copies, not worth caching
+		fd, err := os.Open(file)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return fd, nil, filepath.Base(member), nil
+	}
+	if s.index.lookup(path) {
+		// the working tree copy may differ from what is being committed
+		fd, err := s.index.open(path)
+		if err != nil {
+			return nil, nil, "", err
+		}
+		return fd, nil, filepath.Base(path), nil
+	}
 
-				if err = mpb.Close(); err != nil {
-					sendErr("close multipart writer", err)
-					return
-				}
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	// stat before reading so a file changed mid upload is not cached as unchanged
+	info, err := fd.Stat()
+	if err != nil {
+		_ = fd.Close()
+		return nil, nil, "", err
+	}
+	return fd, info, filepath.Base(path), nil
+}
 
-				if err = pipeWriter.Close(); err != nil {
-					writeDone <- writerResult{err: fmt.Errorf("close pipe writer: %w", err)}
-					return
-				}
+// upload makes a single attempt at processing path. The returned transient
+// is set when the attempt failed in a way worth retrying.
+func (s *service) upload(ctx context.Context, path, callback string, async bool, metadata map[string]string) (resultRecord, *transient) {
+	r := resultRecord{path: path, streamed: path == stdinPath, staged: s.index.lookup(path)}
+
+	fd, info, name, err := s.open(path)
+	if err != nil {
+		slog.Error("could not open file", "path", path, "error", err.Error())
+		r.err = err
+		return r, nil
+	}
+	if path == stdinPath {
+		r.path = name
+	}
+	if _, member, ok := s.archives.lookup(path); ok {
+		metadata = withMetadata(metadata, "archive_member", member)
+	}
 
-				writeDone <- writerResult{sha1: fmt.Sprintf("%x", sha1.Sum(nil))}
-			}()
+	type writerResult struct {
+		sha1 string
+		err  error
+	}
 
-			waitForWriter := func() writerResult {
-				res, ok := <-writeDone
-				if !ok {
-					return writerResult{}
-				}
-				return res
+	pipeReader, pipeWriter := io.Pipe()
+	mpb := multipart.NewWriter(pipeWriter)
+	contentType := mpb.FormDataContentType()
+	writeDone := make(chan writerResult, 1)
+
+	go func() {
+		defer close(writeDone)
+		defer func() { _ = fd.Close() }()
+
+		sha1 := sha1hash.New() //nolint:gosec
+		var src io.Reader = fd
+		if s.bandwidth != nil {
+			src = &limitedReader{ctx: ctx, r: fd, l: s.bandwidth}
+		}
+		fdAndShaReader := io.TeeReader(src, sha1)
+
+		sendErr := func(prefix string, err error) {
+			_ = pipeWriter.CloseWithError(err)
+			writeDone <- writerResult{err: fmt.Errorf("%s: %w", prefix, err)}
+		}
+
+		filePartWriter, err := mpb.CreateFormFile("file", name)
+		if err != nil {
+			sendErr("create form file", err)
+			return
+		}
+
+		if _, err = io.Copy(filePartWriter, fdAndShaReader); err != nil {
+			sendErr("copy file", err)
+			return
+		}
+
+		for k, v := range metadata {
+			if err = mpb.WriteField(fmt.Sprintf("metadata[%s]", k), v); err != nil {
+				sendErr("write metadata", err)
+				return
 			}
+		}
 
-			handleWriterError := func(res writerResult) bool {
-				if res.err == nil {
-					return false
-				}
-				slog.Error("could not build multipart payload", "path", path, "error", res.err.Error())
-				r.err = res.err
-				consumer(r)
-				return true
+		if callback != "" {
+			if err = mpb.WriteField("callback", callback); err != nil {
+				sendErr("write callback", err)
+				return
 			}
+		}
+
+		if err = mpb.Close(); err != nil {
+			sendErr("close multipart writer", err)
+			return
+		}
+
+		if err = pipeWriter.Close(); err != nil {
+			writeDone <- writerResult{err: fmt.Errorf("close pipe writer: %w", err)}
+			return
+		}
+
+		writeDone <- writerResult{sha1: fmt.Sprintf("%x", sha1.Sum(nil))}
+	}()
+
+	waitForWriter := func() writerResult {
+		res, ok := <-writeDone
+		if !ok {
+			return writerResult{}
+		}
+		return res
+	}
 
-			if async {
-				result, err := s.client.ProcessFileAsync(ctx, contentType, pipeReader)
-				if err != nil {
-					_ = pipeWriter.CloseWithError(err)
-					writeRes := waitForWriter()
-					if handleWriterError(writeRes) {
-						return nil
-					}
-					slog.Error("could not process file", "error", err.Error())
-					r.err = err
-					consumer(r)
-					return nil
-				}
+	handleWriterError := func(res writerResult) bool {
+		if res.err == nil {
+			return false
+		}
+		slog.Error("could not build multipart payload", "path", path, "error", res.err.Error())
+		r.err = res.err
+		return true
+	}
 
-				writeRes := waitForWriter()
-				if handleWriterError(writeRes) {
-					return nil
-				}
+	// failed handles a transport error, retrying it unless the run was cancelled
+	failed := func(err error) (resultRecord, *transient) {
+		_ = pipeWriter.CloseWithError(err)
+		writeRes := waitForWriter()
+		// the writer fails too once the request gives up reading, so its
+		// error only matters when the request itself was not at fault
+		if writeRes.err != nil && !errors.Is(writeRes.err, err) && !errors.Is(writeRes.err, io.ErrClosedPipe) {
+			handleWriterError(writeRes)
+			return r, nil
+		}
+		slog.Error("could not process file", "error", err.Error())
+		r.err = err
+		if retryableError(err) {
+			return r, &transient{}
+		}
+		return r, nil
+	}
 
-				if result.StatusCode != http.StatusAccepted {
-					slog.Debug("error processing file", "path", path, "status", result.StatusCode)
-					r.err = fmt.Errorf("error processing file %s, status code %d", path, result.StatusCode)
-				} else {
-					r.id = *result.Pending.ID
-					r.location = result.Header.Get("Location")
-				}
+	// rejected handles an unexpected status, retrying throttling and server errors
+	rejected := func(status int, header http.Header) (resultRecord, *transient) {
+		slog.Debug("error processing file", "path", path, "status", status)
+		r.err = fmt.Errorf("error processing file %s, status code %d", path, status)
+		if retryableStatus(status) {
+			return r, &transient{retryAfter: parseRetryAfter(header)}
+		}
+		return r, nil
+	}
 
-				consumer(r)
-			} else {
-				result, localErr := s.client.ProcessFile(ctx, contentType, pipeReader)
-				if localErr != nil {
-					_ = pipeWriter.CloseWithError(localErr)
-					writeRes := waitForWriter()
-					if handleWriterError(writeRes) {
-						return nil
-					}
-					slog.Error("could not process file", "error", localErr.Error())
-					r.err = localErr
-					consumer(r)
-					return nil
-				}
+	if async {
+		result, err := s.client.ProcessFileAsync(ctx, contentType, pipeReader)
+		if err != nil {
+			return failed(err)
+		}
+
+		writeRes := waitForWriter()
+		if handleWriterError(writeRes) {
+			return r, nil
+		}
+
+		if result.StatusCode != http.StatusAccepted {
+			return rejected(result.StatusCode, result.Header)
+		}
+		r.id = *result.Pending.ID
+		r.location = result.Header.Get("Location")
+		return r, nil
+	}
 
-				writeRes := waitForWriter()
-				if handleWriterError(writeRes) {
-					return nil
-				}
+	result, localErr := s.client.ProcessFile(ctx, contentType, pipeReader)
+	if localErr != nil {
+		return failed(localErr)
+	}
 
-				calculatedSha1 := writeRes.sha1
-				slog.Debug("calculated sha1", "sha1", calculatedSha1)
-
-				slog.Debug("response", "status", result.StatusCode)
-
-				if result.StatusCode != http.StatusCreated {
-					slog.Debug("error processing file", "path", path, "status", result.StatusCode)
-					r.err = fmt.Errorf("error processing file %s, status code %d", path, result.StatusCode)
-				} else {
-					pr := result.Result
-					r.id = *pr.ID
-					if pr.ContentType != nil {
-						r.contentType = *pr.ContentType
-					}
-					if pr.Checksum != nil {
-						r.checksum = *pr.Checksum
-					}
-					if pr.Findings != nil {
-						r.findings = *pr.Findings
-					}
-					if pr.ContentLength != nil {
-						r.contentLength = uint64(*pr.ContentLength)
-					}
-					if pr.CreationDate != nil {
-						r.creationDate = *pr.CreationDate
-					}
-					if pr.Metadata != nil {
-						r.metadata = *pr.Metadata
-					}
-
-					if r.checksum != calculatedSha1 {
-						slog.Error("checksum mismatch", "expected", calculatedSha1, "actual", r.checksum)
-						r.err = fmt.Errorf("checksum mismatch, expected %s, actual %x", calculatedSha1, r.checksum)
-					} else {
-						slog.Debug("checksum verified", "expected", calculatedSha1, "actual", r.checksum)
-					}
-				}
+	writeRes := waitForWriter()
+	if handleWriterError(writeRes) {
+		return r, nil
+	}
 
-				consumer(r)
-			}
+	calculatedSha1 := writeRes.sha1
+	slog.Debug("calculated sha1", "sha1", calculatedSha1)
 
-			return nil
-		})
+	slog.Debug("response", "status", result.StatusCode)
 
+	if result.StatusCode != http.StatusCreated {
+		return rejected(result.StatusCode, result.Header)
 	}
-	err := g.Wait()
-	if err != nil {
-		return err
+
+	pr := result.Result
+	r.id = *pr.ID
+	if pr.ContentType != nil {
+		r.contentType = *pr.ContentType
 	}
-	return nil
+	if pr.Checksum != nil {
+		r.checksum = *pr.Checksum
+	}
+	if pr.Findings != nil {
+		r.findings = *pr.Findings
+	}
+	if pr.ContentLength != nil {
+		r.contentLength = uint64(*pr.ContentLength)
+	}
+	if pr.CreationDate != nil {
+		r.creationDate = *pr.CreationDate
+	}
+	if pr.Metadata != nil {
+		r.metadata = *pr.Metadata
+	}
+
+	if r.checksum != calculatedSha1 {
+		slog.Error("checksum mismatch", "expected", calculatedSha1, "actual", r.checksum)
+		r.err = fmt.Errorf("checksum mismatch, expected %s, actual %x", calculatedSha1, r.checksum)
+	} else {
+		slog.Debug("checksum verified", "expected", calculatedSha1, "actual", r.checksum)
+		if s.cache != nil && info != nil {
+			s.cache.store(path, info, calculatedSha1, metadata, &r)
+		}
+	}
+	return r, nil
 }
@@ -1,7 +1,9 @@
 package file
 
 import (
+	"bytes"
 	"context"
+	"os"
 	"sync"
 	"testing"
 )
@@ -15,6 +17,20 @@ func newTestService(t *testing.T) *service {
 	return svc
 }
 
+// processOne processes a single path and returns its result.
+func processOne(t *testing.T, svc *service, path string) resultRecord {
+	t.Helper()
+	stream := make(chan string, 1)
+	stream <- path
+	close(stream)
+
+	var result resultRecord
+	if err := svc.process(context.Background(), stream, 1, "", false, nil, func(r resultRecord) { result = r }); err != nil {
+		t.Fatalf("process failed: %s", err)
+	}
+	return result
+}
+
 func TestServiceProcessSyncSingleFile(t *testing.T) {
 	svc := newTestService(t)
 
@@ -212,3 +228,22 @@ func TestServiceRetrieveAsync(t *testing.T) {
 
 	checkResponseContent(t, retrieved)
 }
+
+func TestServiceProcessStdin(t *testing.T) {
+	svc := newTestService(t)
+	contents, err := os.ReadFile(fakeMalwareSample)
+	if err != nil {
+		t.Fatalf("read sample: %s", err)
+	}
+	svc.stdin = bytes.NewReader(contents)
+	svc.stdinName = "upload.bin"
+
+	r := processOne(t, svc, stdinPath)
+	if r.err != nil {
+		t.Fatalf("expected no error, got %s", r.err)
+	}
+	if r.path != "upload.bin" {
+		t.Errorf("expected the result to be named upload.bin, got %s", r.path)
+	}
+	checkResponseContent(t, &r)
+}
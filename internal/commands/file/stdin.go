@@ -0,0 +1,39 @@
+package file
+
+import (
+	"io"
+	"sync/atomic"
+	"time"
+
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+)
+
+// stdinPath is the path argument that reads content from standard input.
+const stdinPath = "-"
+
+// defaultStdinName names content read from standard input unless --filename is given.
+const defaultStdinName = "stdin"
+
+// progressReader counts the bytes read from a stream of unknown length,
+// optionally showing a running total.
+type progressReader struct {
+	r     io.Reader
+	n     atomic.Uint64
+	show  bool
+	shown time.Time
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	total := p.n.Add(uint64(n)) //nolint:gosec
+	if p.show {
+		// redrawing on every read would flood the terminal
+		if err == io.EOF {
+			terminal.ProgressBytes("Read", total, true)
+		} else if time.Since(p.shown) > 100*time.Millisecond {
+			terminal.ProgressBytes("Read", total, false)
+			p.shown = time.Now()
+		}
+	}
+	return n, err
+}
@@ -13,13 +13,25 @@ import (
 	"github.com/uvasoftware/scanii-cli/internal/terminal"
 )
 
-func traceCommand(ctx context.Context, profileName *string) *cobra.Command {
+func traceCommand(ctx context.Context, profileName, outputFormat *string) *cobra.Command {
+	var fromFile string
+	concurrency := defaultLookupConcurrency
+
 	cmd := &cobra.Command{
-		Use:        "trace [flags] [id]",
-		Short:      "Retrieve the processing trace for a previously created processing result",
-		Args:       cobra.ExactArgs(1),
+		Use:   "trace [flags] [id...]",
+		Short: "Retrieve the processing trace for previously created processing results",
+		Long: `Retrieve the processing trace for previously created processing results.
+
+Several ids may be given, or read with --from-file from a list with one id per
+line or from the json or ndjson output of a prior run. They are retrieved
+concurrently and reported with a status of complete, not found or error.`,
+		Args:       cobra.ArbitraryArgs,
 		ArgAliases: []string{"id"},
 		RunE: func(_ *cobra.Command, args []string) error {
+			out, err := openOutput(*outputFormat)
+			if err != nil {
+				return err
+			}
 
 			profile, err := profile2.Load(*profileName)
 			if err != nil {
@@ -30,11 +42,28 @@ func traceCommand(ctx context.Context, profileName *string) *cobra.Command {
 				return err
 			}
 
-			_, err = callFileTrace(ctx, c, args[0])
-			return err
+			if len(args) != 1 || fromFile != "" {
+				refs, err := collectIDs(args, fromFile)
+				if err != nil {
+					return err
+				}
+				return traceAll(ctx, c, refs, lookupOptions{concurrency: concurrency, output: out})
+			}
+
+			record, err := callFileTrace(ctx, c, args[0])
+			if err != nil {
+				return err
+			}
+			if err := out.trace(record); err != nil {
+				return err
+			}
+			return out.close()
 		},
 	}
 
+	cmd.PersistentFlags().StringVarP(&fromFile, "from-file", "f", "", "Trace every id listed in this file, - reads the list from standard input")
+	cmd.PersistentFlags().IntVarP(&concurrency, "concurrency", "c", concurrency, "Number of traces retrieved concurrently")
+
 	return cmd
 }
 
@@ -61,7 +90,7 @@ func callFileTrace(ctx context.Context, c *client.Client, id string) (*traceReco
 	}
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("no trace exists for processing id %s", id)
+		return nil, fmt.Errorf("trace for processing id %s %w", id, errNotFound)
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -89,7 +118,6 @@ func callFileTrace(ctx context.Context, c *client.Client, id string) (*traceReco
 		}
 	}
 
-	printTraceResult(&record)
 	return &record, nil
 }
 
@@ -45,7 +45,7 @@ func TestCallFileTraceKnownID(t *testing.T) {
 		c,
 		"http://"+ts.Endpoint+"/static/eicar.txt",
 		"",
-		"",
+		nil,
 	)
 	if err != nil {
 		t.Fatalf("failed to process file: %s", err)
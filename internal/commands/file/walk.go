@@ -0,0 +1,633 @@
+package file
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ignoreFileName is honored in every directory walked, using gitignore syntax.
+const ignoreFileName = ".scaniiignore"
+
+// walkOptions selects which files fsWalker hands to its handler.
+type walkOptions struct {
+	ignoreHidden bool
+	// include, when set, limits files to those matching at least one glob
+	include []string
+	// exclude skips files and prunes directories matching any glob
+	exclude []string
+	// maxDepth limits how deep the walk goes, files directly under the
+	// root are at depth 1 and zero means unlimited
+	maxDepth int
+	// minSize and maxSize bound file sizes, zero means no limit
+	minSize byteSize
+	maxSize byteSize
+	// followSymlinks walks into linked files and directories instead of
+	// skipping them
+	followSymlinks bool
+	// onSkip, when set, is told about every file left out and why
+	onSkip func(path, reason string)
+	// files, when not nil, replaces the directory walk with these slash
+	// separated paths relative to the root
+	files []string
+	// staged, when set, describes the files it holds by their staged
+	// content rather than the working tree copy
+	staged *gitIndex
+}
+
+// pathRule is a compiled glob or gitignore pattern.
+type pathRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+func (r pathRule) match(rel string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	return r.re.MatchString(rel)
+}
+
+// globToRegexp translates a glob into an anchored regular expression.
+// `*` and `?` stop at path separators, `**` crosses them and `**/` also
+// matches no directory at all.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch {
+		case strings.HasPrefix(glob[i:], "**/"):
+			b.WriteString("(?:.*/)?")
+			i += 2
+		case strings.HasPrefix(glob[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		case c == '\\' && i+1 < len(glob):
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		case c == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
+
+// parseRule compiles a gitignore style pattern. Patterns without a slash
+// match at any depth, patterns with one are relative to the base directory,
+// a trailing slash only matches directories and a leading ! negates.
+func parseRule(pattern string) (pathRule, error) {
+	rule := pathRule{}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\!`) || strings.HasPrefix(pattern, `\#`) {
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if pattern == "" {
+		return rule, fmt.Errorf("empty pattern")
+	}
+	if strings.Contains(pattern, "/") {
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		pattern = "**/" + pattern
+	}
+
+	re, err := globToRegexp(pattern)
+	if err != nil {
+		return rule, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	rule.re = re
+	return rule, nil
+}
+
+func parseRules(patterns []string) ([]pathRule, error) {
+	rules := make([]pathRule, 0, len(patterns))
+	for _, p := range patterns {
+		rule, err := parseRule(p)
+		if err != nil {
+			return nil, err
+		}
+		if rule.negate {
+			return nil, fmt.Errorf("invalid pattern %q, negation is only supported in %s files", p, ignoreFileName)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// readIgnoreFile parses a .scaniiignore file, returning no rules when it
+// does not exist.
+func readIgnoreFile(name string) ([]pathRule, error) {
+	fd, err := os.Open(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	defer func() { _ = fd.Close() }()
+
+	var rules []pathRule
+	scanner := bufio.NewScanner(fd)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule, err := parseRule(line)
+		if err != nil {
+			slog.Warn("ignoring invalid pattern", "file", name, "pattern", line, "error", err)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules, scanner.Err()
+}
+
+// walkFilter applies walkOptions and the .scaniiignore files found along
+// the way to paths relative to the walk root.
+type walkFilter struct {
+	opts    walkOptions
+	include []pathRule
+	exclude []pathRule
+	// ignores holds the rules of each directory's .scaniiignore keyed by
+	// its slash separated path relative to the root
+	ignores map[string][]pathRule
+}
+
+func newWalkFilter(opts walkOptions) (*walkFilter, error) {
+	include, err := parseRules(opts.include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := parseRules(opts.exclude)
+	if err != nil {
+		return nil, err
+	}
+	return &walkFilter{opts: opts, include: include, exclude: exclude, ignores: map[string][]pathRule{}}, nil
+}
+
+// ignored evaluates .scaniiignore rules from the root down to the path's
+// parent directory, the last matching rule wins as it does in git.
+func (f *walkFilter) ignored(rel string, isDir bool) bool {
+	ignored := false
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		dir := "."
+		if i > 0 {
+			dir = strings.Join(parts[:i], "/")
+		}
+		sub := strings.Join(parts[i:], "/")
+		for _, rule := range f.ignores[dir] {
+			if rule.match(sub, isDir) {
+				ignored = !rule.negate
+			}
+		}
+	}
+	return ignored
+}
+
+// Reasons a file is left out of a walk, reported in the run summary.
+const (
+	skipHidden      = "hidden"
+	skipMaxDepth    = "max depth"
+	skipExcluded    = "excluded"
+	skipIgnored     = "ignored"
+	skipNotIncluded = "not included"
+	skipTooLarge    = "larger than max size"
+	skipTooSmall    = "smaller than min size"
+	skipNotRegular  = "not a regular file"
+	skipSymlink     = "symlink"
+	skipBrokenLink  = "broken symlink"
+	skipSymlinkLoop = "symlink loop"
+)
+
+// skip returns why a file or directory should be left out of the walk, or
+// an empty string when it should be kept.
+func (f *walkFilter) skip(rel string, isDir bool) string {
+	if f.opts.ignoreHidden && strings.HasPrefix(path.Base(rel), ".") {
+		return skipHidden
+	}
+	if f.opts.maxDepth > 0 {
+		// directories at the limit are pruned since everything in them is deeper
+		depth := strings.Count(rel, "/") + 1
+		if depth > f.opts.maxDepth || (isDir && depth >= f.opts.maxDepth) {
+			return skipMaxDepth
+		}
+	}
+	for _, rule := range f.exclude {
+		if rule.match(rel, isDir) {
+			return skipExcluded
+		}
+	}
+	if f.ignored(rel, isDir) {
+		return skipIgnored
+	}
+	if isDir || len(f.include) == 0 {
+		return ""
+	}
+	for _, rule := range f.include {
+		if rule.match(rel, false) {
+			return ""
+		}
+	}
+	return skipNotIncluded
+}
+
+// skipFile returns why a file that passed the path filters should still be
+// left out based on its type and size.
+func (f *walkFilter) skipFile(info os.FileInfo) string {
+	if !info.Mode().IsRegular() {
+		return skipNotRegular
+	}
+	if f.opts.maxSize > 0 && info.Size() > int64(f.opts.maxSize) {
+		return skipTooLarge
+	}
+	if f.opts.minSize > 0 && info.Size() < int64(f.opts.minSize) {
+		return skipTooSmall
+	}
+	return ""
+}
+
+type walker struct {
+	filter  *walkFilter
+	handler func(path string, d os.DirEntry)
+}
+
+func (w *walker) skipped(p, reason string) {
+	slog.Debug("skipping path", "path", p, "reason", reason)
+	if w.filter.opts.onSkip != nil {
+		w.filter.opts.onSkip(p, reason)
+	}
+}
+
+// file hands a file to the handler unless its type or size rule it out.
+func (w *walker) file(p string, d os.DirEntry, info os.FileInfo) {
+	if reason := w.filter.skipFile(info); reason != "" {
+		w.skipped(p, reason)
+		return
+	}
+	w.handler(p, d)
+}
+
+// realPath resolves every link in p and returns it as an absolute path.
+func realPath(p string) (string, error) {
+	resolved, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(resolved)
+}
+
+// isWithin reports whether p is dir or inside it.
+func isWithin(dir, p string) bool {
+	return p == dir || strings.HasPrefix(p, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// walkDir walks the directory at real, which may be a link resolved to its
+// target, reporting files under base and matching them against paths
+// relative to the overall root by prefixing them with prefix. chain holds
+// the resolved root and every directory link followed to get here, used to
+// detect loops.
+func (w *walker) walkDir(base, real, prefix string, chain []string) error {
+	return filepath.WalkDir(real, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(real, p)
+		if err != nil {
+			return err
+		}
+		p = filepath.Join(base, rel)
+		rel = path.Join(prefix, filepath.ToSlash(rel))
+		if rel == "" {
+			rel = "."
+		}
+
+		switch {
+		case d.IsDir():
+			if rel != prefix && rel != "." {
+				if reason := w.filter.skip(rel, true); reason != "" {
+					slog.Debug("skipping directory", "path", p, "reason", reason)
+					return filepath.SkipDir
+				}
+			}
+			rules, err := readIgnoreFile(filepath.Join(p, ignoreFileName))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", ignoreFileName, err)
+			}
+			if len(rules) > 0 {
+				w.filter.ignores[rel] = rules
+			}
+			return nil
+
+		case d.Type()&os.ModeSymlink != 0:
+			return w.symlink(p, rel, chain)
+		}
+
+		if reason := w.filter.skip(rel, false); reason != "" {
+			w.skipped(p, reason)
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		w.file(p, d, info)
+		return nil
+	})
+}
+
+// symlink follows a link when enabled, walking into linked directories
+// unless that would revisit a directory it is already inside.
+func (w *walker) symlink(p, rel string, chain []string) error {
+	if !w.filter.opts.followSymlinks {
+		if reason := w.filter.skip(rel, false); reason != "" {
+			w.skipped(p, reason)
+		} else {
+			w.skipped(p, skipSymlink)
+		}
+		return nil
+	}
+
+	target, err := os.Stat(p)
+	if err != nil {
+		w.skipped(p, skipBrokenLink)
+		return nil
+	}
+
+	if reason := w.filter.skip(rel, target.IsDir()); reason != "" {
+		if !target.IsDir() {
+			w.skipped(p, reason)
+		}
+		return nil
+	}
+
+	if !target.IsDir() {
+		w.file(p, fs.FileInfoToDirEntry(target), target)
+		return nil
+	}
+
+	resolved, err := realPath(p)
+	if err != nil {
+		w.skipped(p, skipBrokenLink)
+		return nil
+	}
+	parent, err := realPath(filepath.Dir(p))
+	if err != nil {
+		return err
+	}
+	for _, ancestor := range append(chain, parent) {
+		if isWithin(resolved, ancestor) {
+			w.skipped(p, skipSymlinkLoop)
+			return nil
+		}
+	}
+	return w.walkDir(p, resolved, rel, append(chain, resolved))
+}
+
+// fsWalker calls handler for every file under root that passes opts. The
+// same options always select the same files, so it can be used for both
+// counting and uploading. Root itself is always followed when it is a link.
+func fsWalker(root string, opts walkOptions, handler func(path string, d os.DirEntry)) error {
+	filter, err := newWalkFilter(opts)
+	if err != nil {
+		return err
+	}
+	w := &walker{filter: filter, handler: handler}
+
+	info, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+
+	if !info.IsDir() {
+		// a single file is matched by its name
+		if reason := filter.skip(info.Name(), false); reason != "" {
+			w.skipped(root, reason)
+			return nil
+		}
+		w.file(root, fs.FileInfoToDirEntry(info), info)
+		return nil
+	}
+
+	if opts.files != nil {
+		return w.list(root, opts.files)
+	}
+
+	resolved, err := realPath(root)
+	if err != nil {
+		return err
+	}
+	return w.walkDir(root, resolved, "", []string{resolved})
+}
+
+// list hands each listed file to the handler, filtering it as a walk would
+// including the .scaniiignore files of the directories leading to it.
+func (w *walker) list(root string, files []string) error {
+	loaded := map[string]bool{}
+	for _, rel := range files {
+		p := filepath.Join(root, filepath.FromSlash(rel))
+
+		reason := ""
+		parts := strings.Split(rel, "/")
+		// every directory leading to the file, starting at the root
+		for i := range len(parts) {
+			dir := "."
+			if i > 0 {
+				dir = strings.Join(parts[:i], "/")
+				if reason = w.filter.skip(dir, true); reason != "" {
+					break
+				}
+			}
+			if loaded[dir] {
+				continue
+			}
+			loaded[dir] = true
+			rules, err := readIgnoreFile(filepath.Join(root, filepath.FromSlash(dir), ignoreFileName))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", ignoreFileName, err)
+			}
+			if len(rules) > 0 {
+				w.filter.ignores[dir] = rules
+			}
+		}
+		if reason == "" {
+			reason = w.filter.skip(rel, false)
+		}
+		if reason != "" {
+			w.skipped(p, reason)
+			continue
+		}
+
+		if w.filter.opts.staged.lookup(p) {
+			// what is committed is uploaded, even once gone from the working tree
+			info, err := w.filter.opts.staged.stat(p)
+			if err != nil {
+				return err
+			}
+			w.file(p, fs.FileInfoToDirEntry(info), info)
+			continue
+		}
+
+		info, err := os.Lstat(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				// removed since it was listed
+				slog.Debug("skipping missing file", "path", p)
+				continue
+			}
+			return err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			if !w.filter.opts.followSymlinks {
+				w.skipped(p, skipSymlink)
+				continue
+			}
+			if info, err = os.Stat(p); err != nil {
+				w.skipped(p, skipBrokenLink)
+				continue
+			}
+		}
+		w.file(p, fs.FileInfoToDirEntry(info), info)
+	}
+	return nil
+}
+
+// byteSize is a pflag value accepting sizes such as 512, 10KB, 1.5MB or
+// 2GiB, decimal units are powers of 1000 and binary ones powers of 1024.
+type byteSize int64
+
+var byteUnits = map[string]float64{
+	"":    1,
+	"B":   1,
+	"KB":  1e3,
+	"MB":  1e6,
+	"GB":  1e9,
+	"TB":  1e12,
+	"KIB": 1 << 10,
+	"MIB": 1 << 20,
+	"GIB": 1 << 30,
+	"TIB": 1 << 40,
+}
+
+func parseByteSize(s string) (byteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool { return (r < '0' || r > '9') && r != '.' })
+	if i < 0 {
+		i = len(s)
+	}
+	unit, ok := byteUnits[strings.ToUpper(strings.TrimSpace(s[i:]))]
+	if !ok {
+		return 0, fmt.Errorf("invalid size %q, unknown unit", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return byteSize(n * unit), nil
+}
+
+// String formats the size with the largest unit that divides it exactly.
+func (b *byteSize) String() string {
+	for _, unit := range []string{"TiB", "GiB", "MiB", "KiB", "TB", "GB", "MB", "KB"} {
+		size := int64(byteUnits[strings.ToUpper(unit)])
+		if *b != 0 && int64(*b)%size == 0 {
+			return strconv.FormatInt(int64(*b)/size, 10) + unit
+		}
+	}
+	return strconv.FormatInt(int64(*b), 10)
+}
+
+func (b *byteSize) Set(s string) error {
+	v, err := parseByteSize(s)
+	if err != nil {
+		return err
+	}
+	*b = v
+	return nil
+}
+
+func (b *byteSize) Type() string {
+	return "size"
+}
+
+// skipCounts tallies skipped files by reason. It is safe for concurrent use.
+type skipCounts struct {
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+func (s *skipCounts) add(_, reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.counts == nil {
+		s.counts = map[string]int{}
+	}
+	s.counts[reason]++
+}
+
+// total returns the number of files skipped.
+func (s *skipCounts) total() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, c := range s.counts {
+		n += c
+	}
+	return n
+}
+
+// String lists reasons with their counts, most common first.
+func (s *skipCounts) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	reasons := make([]string, 0, len(s.counts))
+	for r := range s.counts {
+		reasons = append(reasons, r)
+	}
+	sort.Slice(reasons, func(i, j int) bool {
+		if s.counts[reasons[i]] != s.counts[reasons[j]] {
+			return s.counts[reasons[i]] > s.counts[reasons[j]]
+		}
+		return reasons[i] < reasons[j]
+	})
+	parts := make([]string, len(reasons))
+	for i, r := range reasons {
+		parts[i] = fmt.Sprintf("%s: %d", r, s.counts[r])
+	}
+	return strings.Join(parts, ", ")
+}
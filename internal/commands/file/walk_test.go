@@ -0,0 +1,283 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// makeTree creates files, given as slash separated paths, under a temp dir.
+func makeTree(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatalf("mkdir: %s", err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0600); err != nil {
+			t.Fatalf("write: %s", err)
+		}
+	}
+	return root
+}
+
+func walked(t *testing.T, root string, opts walkOptions) []string {
+	t.Helper()
+	var files []string
+	err := fsWalker(root, opts, func(p string, _ os.DirEntry) {
+		rel, _ := filepath.Rel(root, p)
+		files = append(files, filepath.ToSlash(rel))
+	})
+	if err != nil {
+		t.Fatalf("fsWalker: %s", err)
+	}
+	sort.Strings(files)
+	return files
+}
+
+var walkTree = map[string]string{
+	"a.exe":                 "",
+	"readme.md":             "",
+	"src/main.go":           "",
+	"src/lib/util.go":       "",
+	"src/lib/util.exe":      "",
+	"node_modules/x/i.js":   "",
+	"build/out/app.exe":     "",
+	"build/out/app.log":     "",
+	"docs/deep/er/file.txt": "",
+}
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob, path string
+		want       bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "src/main.go", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/lib/util.go", true},
+		{"src/**", "src/lib/util.go", true},
+		{"**/lib", "src/lib", true},
+		{"file.?xe", "file.exe", true},
+		{"[!a]*.txt", "b.txt", true},
+		{"[!a]*.txt", "a.txt", false},
+		{`\*.txt`, "*.txt", true},
+	}
+	for _, tt := range tests {
+		re, err := globToRegexp(tt.glob)
+		if err != nil {
+			t.Fatalf("%s: %s", tt.glob, err)
+		}
+		if got := re.MatchString(tt.path); got != tt.want {
+			t.Errorf("%s against %s: want %v, got %v", tt.glob, tt.path, tt.want, got)
+		}
+	}
+}
+
+func TestFsWalkerIncludeExclude(t *testing.T) {
+	root := makeTree(t, walkTree)
+
+	got := walked(t, root, walkOptions{include: []string{"*.exe"}, exclude: []string{"build/"}})
+	want := []string{"a.exe", "src/lib/util.exe"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	got = walked(t, root, walkOptions{include: []string{"src/**/*.go"}})
+	want = []string{"src/lib/util.go", "src/main.go"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("want %v, got %v", want, got)
+	}
+
+	got = walked(t, root, walkOptions{exclude: []string{"node_modules", "**/*.log", "docs/**"}})
+	for _, f := range got {
+		if strings.HasPrefix(f, "node_modules/") || strings.HasSuffix(f, ".log") || strings.HasPrefix(f, "docs/") {
+			t.Errorf("expected %s to be excluded", f)
+		}
+	}
+	if len(got) != 6 {
+		t.Errorf("want 6 files, got %v", got)
+	}
+}
+
+func TestFsWalkerMaxDepth(t *testing.T) {
+	root := makeTree(t, walkTree)
+
+	got := walked(t, root, walkOptions{maxDepth: 1})
+	if strings.Join(got, ",") != "a.exe,readme.md" {
+		t.Errorf("unexpected files at depth 1: %v", got)
+	}
+	got = walked(t, root, walkOptions{maxDepth: 2})
+	if strings.Join(got, ",") != "a.exe,readme.md,src/main.go" {
+		t.Errorf("unexpected files at depth 2: %v", got)
+	}
+}
+
+func TestFsWalkerScaniiIgnore(t *testing.T) {
+	tree := map[string]string{
+		ignoreFileName:          "# build output\nbuild/\n*.log\n!keep.log\n/readme.md\n",
+		"src/" + ignoreFileName: "lib/*.exe\n",
+	}
+	for k, v := range walkTree {
+		tree[k] = v
+	}
+	tree["keep.log"] = ""
+	tree["src/readme.md"] = ""
+	root := makeTree(t, tree)
+
+	got := walked(t, root, walkOptions{ignoreHidden: true})
+	want := []string{
+		"a.exe",
+		"docs/deep/er/file.txt",
+		"keep.log",
+		"node_modules/x/i.js",
+		"src/lib/util.go",
+		"src/main.go",
+		"src/readme.md",
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+}
+
+func TestFsWalkerFiles(t *testing.T) {
+	tree := map[string]string{"src/" + ignoreFileName: "*.log\n"}
+	for k, v := range walkTree {
+		tree[k] = v
+	}
+	tree["src/debug.log"] = ""
+	root := makeTree(t, tree)
+
+	files := []string{"a.exe", "src/main.go", "src/debug.log", "node_modules/x/i.js", "docs/deep/er/file.txt", "removed.txt"}
+	got, reasons := skippedBy(t, root, walkOptions{exclude: []string{"node_modules/"}, maxDepth: 3, files: files})
+	if want := []string{"a.exe", "src/main.go"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("want %v\ngot  %v", want, got)
+	}
+	for reason, want := range map[string]string{skipIgnored: "src/debug.log", skipExcluded: "node_modules/x/i.js", skipMaxDepth: "docs/deep/er/file.txt"} {
+		if strings.Join(reasons[reason], ",") != want {
+			t.Errorf("expected %s to be skipped as %s, got %v", want, reason, reasons)
+		}
+	}
+
+	if got := walked(t, root, walkOptions{files: []string{}}); len(got) != 0 {
+		t.Errorf("expected an empty list to select nothing, got %v", got)
+	}
+}
+
+func TestFsWalkerInvalidPattern(t *testing.T) {
+	if err := fsWalker(t.TempDir(), walkOptions{exclude: []string{"!negated"}}, func(string, os.DirEntry) {}); err == nil {
+		t.Error("expected an error for a negated exclude")
+	}
+}
+
+// skippedBy walks root and returns skipped files keyed by reason.
+func skippedBy(t *testing.T, root string, opts walkOptions) ([]string, map[string][]string) {
+	t.Helper()
+	reasons := map[string][]string{}
+	opts.onSkip = func(p, reason string) {
+		rel, _ := filepath.Rel(root, p)
+		reasons[reason] = append(reasons[reason], filepath.ToSlash(rel))
+	}
+	return walked(t, root, opts), reasons
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]byteSize{
+		"512":   512,
+		"10KB":  10_000,
+		"1.5mb": 1_500_000,
+		"2GiB":  2 << 30,
+		"1 KiB": 1024,
+	}
+	for in, want := range tests {
+		got, err := parseByteSize(in)
+		if err != nil {
+			t.Fatalf("%s: %s", in, err)
+		}
+		if got != want {
+			t.Errorf("%s: want %d, got %d", in, want, got)
+		}
+	}
+	for in, want := range map[byteSize]string{0: "0", 1 << 30: "1GiB", 10_000_000: "10MB", 1500: "1500"} {
+		if got := in.String(); got != want {
+			t.Errorf("%d: want %s, got %s", in, want, got)
+		}
+	}
+	for _, in := range []string{"", "ten", "10XB", "-1"} {
+		if _, err := parseByteSize(in); err == nil {
+			t.Errorf("expected an error for %q", in)
+		}
+	}
+}
+
+func TestFsWalkerSize(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"empty.txt": "",
+		"small.txt": "12345",
+		"large.txt": strings.Repeat("x", 2048),
+	})
+
+	got, reasons := skippedBy(t, root, walkOptions{minSize: 1, maxSize: 1024})
+	if strings.Join(got, ",") != "small.txt" {
+		t.Errorf("unexpected files %v", got)
+	}
+	if len(reasons[skipTooSmall]) != 1 || len(reasons[skipTooLarge]) != 1 {
+		t.Errorf("unexpected skip reasons %v", reasons)
+	}
+}
+
+func TestFsWalkerSymlinks(t *testing.T) {
+	root := makeTree(t, map[string]string{
+		"a/file.txt":   "",
+		"outside/x.go": "",
+	})
+	links := map[string]string{
+		"a/loop":   root,
+		"a/self":   filepath.Join(root, "a"),
+		"a/linked": filepath.Join(root, "outside"),
+		"a/file":   filepath.Join(root, "a", "file.txt"),
+		"a/broken": filepath.Join(root, "missing"),
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(root, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symlinks not supported: %s", err)
+		}
+	}
+	dir := filepath.Join(root, "a")
+
+	got, reasons := skippedBy(t, dir, walkOptions{})
+	if strings.Join(got, ",") != "file.txt" {
+		t.Errorf("unexpected files without following links %v", got)
+	}
+	if len(reasons[skipSymlink]) != len(links) {
+		t.Errorf("expected every link to be skipped, got %v", reasons)
+	}
+
+	got, reasons = skippedBy(t, dir, walkOptions{followSymlinks: true})
+	if strings.Join(got, ",") != "file,file.txt,linked/x.go" {
+		t.Errorf("unexpected files following links %v", got)
+	}
+	sort.Strings(reasons[skipSymlinkLoop])
+	if strings.Join(reasons[skipSymlinkLoop], ",") != "loop,self" {
+		t.Errorf("expected loops to be detected, got %v", reasons)
+	}
+	if strings.Join(reasons[skipBrokenLink], ",") != "broken" {
+		t.Errorf("expected a broken link, got %v", reasons)
+	}
+}
+
+func TestSkipCounts(t *testing.T) {
+	s := &skipCounts{}
+	for _, r := range []string{skipHidden, skipTooLarge, skipTooLarge, skipSymlink} {
+		s.add("", r)
+	}
+	if s.total() != 4 {
+		t.Errorf("want 4 skipped, got %d", s.total())
+	}
+	if got := s.String(); got != "larger than max size: 2, hidden: 1, symlink: 1" {
+		t.Errorf("unexpected summary %q", got)
+	}
+}
@@ -0,0 +1,25 @@
+//go:build !windows
+
+package file
+
+import (
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestFsWalkerSkipsSpecialFiles(t *testing.T) {
+	root := makeTree(t, map[string]string{"file.txt": "content"})
+	if err := syscall.Mkfifo(filepath.Join(root, "pipe"), 0600); err != nil {
+		t.Skipf("mkfifo not supported: %s", err)
+	}
+
+	got, reasons := skippedBy(t, root, walkOptions{})
+	if strings.Join(got, ",") != "file.txt" {
+		t.Errorf("unexpected files %v", got)
+	}
+	if strings.Join(reasons[skipNotRegular], ",") != "pipe" {
+		t.Errorf("expected the pipe to be skipped, got %v", reasons)
+	}
+}
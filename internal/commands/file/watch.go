@@ -0,0 +1,358 @@
+package file
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/uvasoftware/scanii-cli/internal/commands/profile"
+	"github.com/uvasoftware/scanii-cli/internal/terminal"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Defaults for watching a directory.
+const (
+	defaultDebounce        = 2 * time.Second
+	defaultSummaryInterval = time.Minute
+)
+
+// watchOptions holds the settings of the watch command on top of those
+// shared with process.
+type watchOptions struct {
+	processOptions
+	// debounce is how long a file must go unchanged before it is uploaded
+	debounce time.Duration
+	// interval is how often a summary is printed, zero disables it
+	interval time.Duration
+	// existing queues the files already in the directory when watching starts
+	existing bool
+}
+
+func watchCommand(ctx context.Context, profile *string, metadata *metadataFlags, outputFormat *string) *cobra.Command {
+	opts := watchOptions{
+		processOptions: processOptions{concurrency: 32 * runtime.NumCPU(), retry: defaultRetryPolicy()},
+		debounce:       defaultDebounce,
+		interval:       defaultSummaryInterval,
+	}
+	actions := &remediation{}
+
+	cmd := &cobra.Command{
+		Use:        "watch [flags] [directory]",
+		Args:       cobra.ExactArgs(1),
+		ArgAliases: []string{"directory"},
+		Short:      "Watch a directory and process files as they are written",
+		// a summary is printed once interrupted
+		Annotations: map[string]string{HandlesSignalsAnnotation: "true"},
+		Long: `Watch a directory recursively and process every file created or modified in it
+once it has stopped changing. Runs until interrupted, printing a summary periodically
+and once more on exit.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			out, err := openOutput(*outputFormat)
+			if err != nil {
+				return err
+			}
+			if actions.enabled() {
+				if err := actions.validate(); err != nil {
+					return err
+				}
+				opts.remediation = actions
+			}
+			if opts.debounce <= 0 {
+				return fmt.Errorf("--debounce must be positive")
+			}
+			if opts.metadata, err = metadata.parse(); err != nil {
+				return err
+			}
+			opts.output = out
+			return watch(ctx, *profile, args[0], opts)
+		},
+	}
+
+	cmd.PersistentFlags().StringVar(&opts.callback, "callback", "", "Callback URL to be invoked when processing is complete")
+	cmd.PersistentFlags().IntVarP(&opts.concurrency, "concurrency", "c", opts.concurrency, "Number of concurrent requests to use")
+	addWalkFlags(cmd, &opts.walk)
+	addRetryFlags(cmd, &opts.retry)
+	addLimitFlags(cmd, &opts.processOptions)
+	addActionFlags(cmd, actions)
+	cmd.PersistentFlags().DurationVar(&opts.debounce, "debounce", opts.debounce, "How long a file must go unchanged before it is processed, so partial writes are not uploaded")
+	cmd.PersistentFlags().DurationVar(&opts.interval, "summary-interval", opts.interval, "How often to print a summary while watching, 0 only prints it on exit")
+	cmd.PersistentFlags().BoolVar(&opts.existing, "existing", false, "Also process the files already in the directory when watching starts")
+
+	return cmd
+}
+
+// watchEvent is a file or directory created or written to in a watched directory.
+type watchEvent struct {
+	path string
+	dir  bool
+}
+
+// fileWatcher reports changes to the entries of the directories added to
+// it, subdirectories have to be added on their own. newFileWatcher uses
+// inotify where it is available and polls elsewhere.
+type fileWatcher interface {
+	add(dir string) error
+	events() <-chan watchEvent
+	errors() <-chan error
+	close() error
+}
+
+// pendingFile is a changed file waiting to settle.
+type pendingFile struct {
+	changed time.Time
+	size    int64
+	modTime time.Time
+}
+
+// debouncer holds changed files back until they have stopped changing, so
+// files still being written are not uploaded half way through. A file is
+// ready once no change was reported for delay and its size and modification
+// time are the same as when the last change was seen.
+type debouncer struct {
+	delay   time.Duration
+	pending map[string]pendingFile
+}
+
+func newDebouncer(delay time.Duration) *debouncer {
+	return &debouncer{delay: delay, pending: map[string]pendingFile{}}
+}
+
+// touch records a change to path, restarting its wait.
+func (d *debouncer) touch(path string, now time.Time) {
+	info, err := os.Lstat(path)
+	if err != nil {
+		// gone already, nothing to upload
+		delete(d.pending, path)
+		return
+	}
+	d.pending[path] = pendingFile{changed: now, size: info.Size(), modTime: info.ModTime()}
+}
+
+// ready returns the files that have settled and stops tracking them.
+func (d *debouncer) ready(now time.Time) []string {
+	var paths []string
+	for path, f := range d.pending {
+		if now.Sub(f.changed) < d.delay {
+			continue
+		}
+		info, err := os.Lstat(path)
+		if err != nil {
+			delete(d.pending, path)
+			continue
+		}
+		// writers that pause longer than delay are caught here even when
+		// the change itself was not reported
+		if info.Size() != f.size || !info.ModTime().Equal(f.modTime) {
+			d.pending[path] = pendingFile{changed: now, size: info.Size(), modTime: info.ModTime()}
+			continue
+		}
+		delete(d.pending, path)
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func watch(ctx context.Context, profileName string, dir string, opts watchOptions) error {
+	out := opts.output
+	if out == nil {
+		out = newOutput(outputText, os.Stdout)
+	}
+
+	p, err := profile.Load(profileName)
+	if err != nil {
+		return fmt.Errorf("failed to load profile: %w", err)
+	}
+
+	terminal.Info(fmt.Sprintf("Using endpoint: %s and API key: %s", p.Endpoint, p.APIKey()))
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return fmt.Errorf("failed to stat path: %w", err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	// files already quarantined or renamed are not scanned again
+	if opts.remediation != nil {
+		opts.walk.exclude = append(opts.walk.exclude, opts.remediation.exclusions(dir)...)
+	}
+	filter, err := newWalkFilter(opts.walk)
+	if err != nil {
+		return err
+	}
+
+	fs, err := newUploadService(p, opts.processOptions, dir)
+	if err != nil {
+		return err
+	}
+	results := newResultConsumer(out, opts.processOptions)
+
+	if opts.remediation != nil {
+		if err := opts.remediation.open(dir); err != nil {
+			return err
+		}
+		defer func() { _ = opts.remediation.close() }()
+	}
+
+	watcher, err := newFileWatcher()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = watcher.close() }()
+
+	deb := newDebouncer(opts.debounce)
+
+	// enqueue starts the wait on a changed file unless the filters leave it out
+	enqueue := func(path string, now time.Time) {
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return
+		}
+		rel = filepath.ToSlash(rel)
+		if filepath.Base(path) == ignoreFileName {
+			// edited ignore files apply to the changes that follow
+			rules, err := readIgnoreFile(path)
+			if err != nil {
+				slog.Warn("failed to read ignore file", "path", path, "error", err)
+			} else {
+				filter.ignores[filepath.ToSlash(filepath.Dir(rel))] = rules
+			}
+		}
+		if reason := filter.skip(rel, false); reason != "" {
+			slog.Debug("skipping path", "path", path, "reason", reason)
+			return
+		}
+		deb.touch(path, now)
+	}
+
+	// addTree watches root and every directory below it the filters allow,
+	// queueing the files already there when queue is set
+	addTree := func(root string, queue bool) error {
+		now := time.Now()
+		return filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err
+				}
+				slog.Warn("failed to read path", "path", path, "error", err)
+				return nil
+			}
+			rel, err := filepath.Rel(dir, path)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			if !d.IsDir() {
+				if queue {
+					enqueue(path, now)
+				}
+				return nil
+			}
+			if rel != "." {
+				if reason := filter.skip(rel, true); reason != "" {
+					slog.Debug("skipping directory", "path", path, "reason", reason)
+					return filepath.SkipDir
+				}
+			}
+			rules, err := readIgnoreFile(filepath.Join(path, ignoreFileName))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", ignoreFileName, err)
+			}
+			if len(rules) > 0 {
+				filter.ignores[rel] = rules
+			}
+			if err := watcher.add(path); err != nil {
+				return fmt.Errorf("failed to watch %s: %w", path, err)
+			}
+			return nil
+		})
+	}
+
+	if err := addTree(dir, opts.existing); err != nil {
+		return err
+	}
+	terminal.Info(fmt.Sprintf("Watching %s, press Ctrl+C to stop", dir))
+
+	ctx, span := tracer.Start(ctx, "files.watch", trace.WithAttributes(attribute.String("path", dir)))
+	defer span.End()
+
+	startTime := time.Now()
+	summary := func() {
+		terminal.Info(fmt.Sprintf("Watching for %s: %d file(s) analyzed, %d with findings, %d unable to process", terminal.FormatDuration(time.Since(startTime)), results.finished.Load(), results.withFindings.Load(), results.failed.Load()))
+	}
+
+	fileChannel := make(chan string)
+	go func() {
+		defer close(fileChannel)
+
+		tick := time.NewTicker(max(opts.debounce/4, 10*time.Millisecond))
+		defer tick.Stop()
+		var summaries <-chan time.Time
+		if opts.interval > 0 {
+			t := time.NewTicker(opts.interval)
+			defer t.Stop()
+			summaries = t.C
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				if n := len(deb.pending); n > 0 {
+					terminal.Warn(fmt.Sprintf("Stopped with %d file(s) still changing, they were not processed", n))
+				}
+				return
+			case e, ok := <-watcher.events():
+				if !ok {
+					return
+				}
+				if e.dir {
+					// files may have been written before the directory was watched
+					if err := addTree(e.path, true); err != nil {
+						terminal.Warn(err.Error())
+					}
+					continue
+				}
+				enqueue(e.path, time.Now())
+			case err := <-watcher.errors():
+				terminal.Warn(fmt.Sprintf("Watch error: %s", err))
+			case now := <-tick.C:
+				for _, path := range deb.ready(now) {
+					info, err := os.Lstat(path)
+					if err != nil {
+						continue
+					}
+					if reason := filter.skipFile(info); reason != "" {
+						slog.Debug("skipping path", "path", path, "reason", reason)
+						continue
+					}
+					select {
+					case fileChannel <- path:
+					case <-ctx.Done():
+						return
+					}
+				}
+			case <-summaries:
+				summary()
+			}
+		}
+	}()
+
+	// interrupting stops watching, uploads already started are allowed to finish
+	err = fs.process(context.WithoutCancel(ctx), fileChannel, opts.concurrency, opts.callback, false, opts.metadata, results.finish)
+	if err != nil {
+		return err
+	}
+	if err := out.close(); err != nil {
+		return fmt.Errorf("failed to write output: %w", err)
+	}
+	return results.printSummary(fmt.Sprintf("Watched %s for %s, %s file(s) analyzed", dir, terminal.FormatDuration(time.Since(startTime)), terminal.FormatNumber(int64(results.finished.Load())))) //nolint:gosec
+}
@@ -0,0 +1,142 @@
+//go:build linux
+
+package file
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// inotifyMask selects the events that may leave a file ready to upload.
+const inotifyMask = syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO
+
+// inotifyWatcher watches directories with inotify(7).
+type inotifyWatcher struct {
+	fd   int
+	file *os.File
+
+	mu   sync.Mutex
+	dirs map[int32]string
+
+	ev   chan watchEvent
+	errs chan error
+	done chan struct{}
+}
+
+func newFileWatcher() (fileWatcher, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start inotify: %w", err)
+	}
+	w := &inotifyWatcher{
+		fd: fd,
+		// a non blocking descriptor goes through the runtime poller, so
+		// closing the file interrupts a pending read
+		file: os.NewFile(uintptr(fd), "inotify"),
+		dirs: map[int32]string{},
+		ev:   make(chan watchEvent, 64),
+		errs: make(chan error, 1),
+		done: make(chan struct{}),
+	}
+	go w.read()
+	return w, nil
+}
+
+func (w *inotifyWatcher) add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(w.fd, dir, inotifyMask)
+	if err != nil {
+		if errors.Is(err, syscall.ENOSPC) {
+			return fmt.Errorf("%w, raise fs.inotify.max_user_watches", err)
+		}
+		return err
+	}
+	w.mu.Lock()
+	w.dirs[int32(wd)] = dir //nolint:gosec
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *inotifyWatcher) events() <-chan watchEvent {
+	return w.ev
+}
+
+func (w *inotifyWatcher) errors() <-chan error {
+	return w.errs
+}
+
+func (w *inotifyWatcher) close() error {
+	close(w.done)
+	return w.file.Close()
+}
+
+func (w *inotifyWatcher) read() {
+	defer close(w.ev)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.fail(err)
+			}
+			return
+		}
+		for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+			// struct inotify_event: wd, mask, cookie, len and a NUL padded name
+			wd := int32(binary.NativeEndian.Uint32(buf[off:])) //nolint:gosec
+			mask := binary.NativeEndian.Uint32(buf[off+4:])
+			size := int(binary.NativeEndian.Uint32(buf[off+12:]))
+			start := off + syscall.SizeofInotifyEvent
+			name := strings.TrimRight(string(buf[start:min(start+size, n)]), "\x00")
+			off = start + size
+
+			if !w.handle(wd, mask, name) {
+				return
+			}
+		}
+	}
+}
+
+// handle turns a raw event into a watchEvent, returning false once closed.
+func (w *inotifyWatcher) handle(wd int32, mask uint32, name string) bool {
+	if mask&syscall.IN_Q_OVERFLOW != 0 {
+		w.fail(fmt.Errorf("inotify queue overflowed, some changes were missed"))
+		return true
+	}
+
+	w.mu.Lock()
+	dir, ok := w.dirs[wd]
+	if mask&syscall.IN_IGNORED != 0 {
+		// the directory was removed or unmounted
+		delete(w.dirs, wd)
+	}
+	w.mu.Unlock()
+	if !ok || name == "" {
+		return true
+	}
+
+	e := watchEvent{path: filepath.Join(dir, name), dir: mask&syscall.IN_ISDIR != 0}
+	if e.dir && mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 {
+		return true
+	}
+	select {
+	case w.ev <- e:
+		return true
+	case <-w.done:
+		return false
+	}
+}
+
+// fail reports an error without blocking, one pending error is enough.
+func (w *inotifyWatcher) fail(err error) {
+	select {
+	case w.errs <- err:
+	default:
+	}
+}
@@ -0,0 +1,142 @@
+//go:build !linux
+
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pollInterval is how often watched directories are listed.
+const pollInterval = time.Second
+
+// polledEntry is what was last seen of a directory entry.
+type polledEntry struct {
+	size    int64
+	modTime time.Time
+	dir     bool
+}
+
+// pollWatcher watches directories by listing them periodically, used where
+// inotify is not available.
+type pollWatcher struct {
+	mu   sync.Mutex
+	dirs map[string]map[string]polledEntry
+
+	ev   chan watchEvent
+	errs chan error
+	done chan struct{}
+}
+
+func newFileWatcher() (fileWatcher, error) {
+	w := &pollWatcher{
+		dirs: map[string]map[string]polledEntry{},
+		ev:   make(chan watchEvent, 64),
+		errs: make(chan error, 1),
+		done: make(chan struct{}),
+	}
+	go w.run()
+	return w, nil
+}
+
+// add starts watching dir, the entries already in it are not reported.
+func (w *pollWatcher) add(dir string) error {
+	entries, err := listDir(dir)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.dirs[dir] = entries
+	w.mu.Unlock()
+	return nil
+}
+
+func (w *pollWatcher) events() <-chan watchEvent {
+	return w.ev
+}
+
+func (w *pollWatcher) errors() <-chan error {
+	return w.errs
+}
+
+func (w *pollWatcher) close() error {
+	close(w.done)
+	return nil
+}
+
+func listDir(dir string) (map[string]polledEntry, error) {
+	items, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]polledEntry, len(items))
+	for _, item := range items {
+		info, err := item.Info()
+		if err != nil {
+			// removed while listing
+			continue
+		}
+		entries[item.Name()] = polledEntry{size: info.Size(), modTime: info.ModTime(), dir: item.IsDir()}
+	}
+	return entries, nil
+}
+
+func (w *pollWatcher) run() {
+	defer close(w.ev)
+
+	tick := time.NewTicker(pollInterval)
+	defer tick.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-tick.C:
+		}
+
+		w.mu.Lock()
+		dirs := make([]string, 0, len(w.dirs))
+		for dir := range w.dirs {
+			dirs = append(dirs, dir)
+		}
+		w.mu.Unlock()
+
+		for _, dir := range dirs {
+			if !w.poll(dir) {
+				return
+			}
+		}
+	}
+}
+
+// poll lists dir and reports what changed since the last listing,
+// returning false once closed.
+func (w *pollWatcher) poll(dir string) bool {
+	entries, err := listDir(dir)
+	w.mu.Lock()
+	previous := w.dirs[dir]
+	if err != nil {
+		// the directory was removed, stop watching it
+		delete(w.dirs, dir)
+	} else {
+		w.dirs[dir] = entries
+	}
+	w.mu.Unlock()
+	if err != nil {
+		return true
+	}
+
+	for name, entry := range entries {
+		before, seen := previous[name]
+		if seen && (entry.dir || (before.size == entry.size && before.modTime.Equal(entry.modTime))) {
+			continue
+		}
+		select {
+		case w.ev <- watchEvent{path: filepath.Join(dir, name), dir: entry.dir}:
+		case <-w.done:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,119 @@
+package file
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestDebouncer(t *testing.T) {
+	dir := t.TempDir()
+	done := filepath.Join(dir, "done.txt")
+	growing := filepath.Join(dir, "growing.txt")
+	removed := filepath.Join(dir, "removed.txt")
+	for _, path := range []string{done, growing, removed} {
+		writeTestFile(t, path)
+	}
+
+	d := newDebouncer(time.Second)
+	start := time.Now()
+	for _, path := range []string{done, growing, removed} {
+		d.touch(path, start)
+	}
+	d.touch(filepath.Join(dir, "missing.txt"), start)
+
+	if ready := d.ready(start.Add(500 * time.Millisecond)); len(ready) != 0 {
+		t.Fatalf("expected nothing before the delay, got %v", ready)
+	}
+
+	// written to without an event being reported
+	if err := os.WriteFile(growing, []byte("more content"), 0600); err != nil {
+		t.Fatalf("write: %s", err)
+	}
+	if err := os.Remove(removed); err != nil {
+		t.Fatalf("remove: %s", err)
+	}
+
+	later := start.Add(time.Second)
+	if ready := d.ready(later); !slices.Equal(ready, []string{done}) {
+		t.Fatalf("expected only %s to be ready, got %v", done, ready)
+	}
+	if ready := d.ready(later.Add(500 * time.Millisecond)); len(ready) != 0 {
+		t.Fatalf("expected the changed file to wait again, got %v", ready)
+	}
+	if ready := d.ready(later.Add(time.Second)); !slices.Equal(ready, []string{growing}) {
+		t.Fatalf("expected %s to be ready, got %v", growing, ready)
+	}
+	if len(d.pending) != 0 {
+		t.Errorf("expected nothing left pending, got %v", d.pending)
+	}
+}
+
+func TestDebouncerTouchRestartsWait(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file.txt")
+	writeTestFile(t, path)
+
+	d := newDebouncer(time.Second)
+	start := time.Now()
+	d.touch(path, start)
+	d.touch(path, start.Add(800*time.Millisecond))
+	if ready := d.ready(start.Add(time.Second)); len(ready) != 0 {
+		t.Fatalf("expected the second change to restart the wait, got %v", ready)
+	}
+	if ready := d.ready(start.Add(1800 * time.Millisecond)); len(ready) != 1 {
+		t.Fatalf("expected the file to be ready, got %v", ready)
+	}
+}
+
+// nextEvent waits for an event about path, ignoring any others.
+func nextEvent(t *testing.T, w fileWatcher, path string) watchEvent {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case e := <-w.events():
+			if e.path == path {
+				return e
+			}
+		case err := <-w.errors():
+			t.Fatalf("watch error: %s", err)
+		case <-timeout:
+			t.Fatalf("timed out waiting for an event about %s", path)
+		}
+	}
+}
+
+func TestFileWatcher(t *testing.T) {
+	dir := t.TempDir()
+	w, err := newFileWatcher()
+	if err != nil {
+		t.Fatalf("newFileWatcher: %s", err)
+	}
+	defer func() { _ = w.close() }()
+	if err := w.add(dir); err != nil {
+		t.Fatalf("add: %s", err)
+	}
+
+	file := filepath.Join(dir, "upload.bin")
+	writeTestFile(t, file)
+	if e := nextEvent(t, w, file); e.dir {
+		t.Errorf("expected a file event, got %+v", e)
+	}
+
+	sub := filepath.Join(dir, "batch")
+	if err := os.Mkdir(sub, 0700); err != nil {
+		t.Fatalf("mkdir: %s", err)
+	}
+	if e := nextEvent(t, w, sub); !e.dir {
+		t.Errorf("expected a directory event, got %+v", e)
+	}
+
+	if err := w.add(sub); err != nil {
+		t.Fatalf("add: %s", err)
+	}
+	nested := filepath.Join(sub, "nested.bin")
+	writeTestFile(t, nested)
+	nextEvent(t, w, nested)
+}
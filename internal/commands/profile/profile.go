@@ -16,6 +16,7 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/uvasoftware/scanii-cli/internal/client"
+	"github.com/uvasoftware/scanii-cli/internal/telemetry"
 	"github.com/uvasoftware/scanii-cli/internal/terminal"
 	"github.com/uvasoftware/scanii-cli/internal/vcs"
 )
@@ -237,6 +238,8 @@ func (c *Profile) Client() (*client.Client, error) {
 			req.Header.Add("User-Agent", fmt.Sprintf("github.com/uvasoftware/scanii-cli/v%s", vcs.Version()))
 			return nil
 		}),
+		// propagate the caller's span so uploads can be followed into the server
+		client.WithRequestEditorFn(telemetry.InjectHeaders),
 		// The Scanii API has a maximum processing time of 30 minutes per request.
 		// We use transport-level timeouts instead of http.Client.Timeout so that
 		// the upload transfer time is not counted against the deadline.
@@ -0,0 +1,418 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+const redacted = "REDACTED"
+
+// redactedHeaders never make it into a cassette.
+var redactedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "Proxy-Authorization"}
+
+// Interaction is a recorded request/response pair.
+type Interaction struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+	// Hash is the sha256 of the uploaded file or of the location to fetch,
+	// empty for requests that carry neither.
+	Hash     string      `json:"hash,omitempty"`
+	Request  http.Header `json:"request_headers,omitempty"`
+	Status   int         `json:"status"`
+	Response http.Header `json:"response_headers,omitempty"`
+	Body     string      `json:"body,omitempty"`
+}
+
+// Cassette is a set of interactions recorded against an upstream API. It is
+// saved as newline delimited JSON, a header line holding the upstream
+// followed by one line per interaction, so recording only ever appends.
+type Cassette struct {
+	Upstream     string         `json:"upstream"`
+	Interactions []*Interaction `json:"-"`
+
+	mu   sync.Mutex
+	path string
+	next map[string]int
+	// tokens maps the auth token ids seen while recording to the
+	// placeholders written in their place
+	tokens map[string]string
+}
+
+// LoadCassette reads a cassette previously written in record mode.
+func LoadCassette(path string) (*Cassette, error) {
+	fd, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	c := &Cassette{path: path}
+	scanner := bufio.NewScanner(fd)
+	// response bodies are recorded whole
+	scanner.Buffer(nil, 64*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var err error
+		if n == 1 {
+			err = json.Unmarshal(line, c)
+		} else {
+			i := &Interaction{}
+			err = json.Unmarshal(line, i)
+			c.Interactions = append(c.Interactions, i)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse line %d of cassette %s: %w", n, path, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read cassette %s: %w", path, err)
+	}
+	return c, nil
+}
+
+// NewCassette returns an empty cassette that is saved to path as interactions
+// are recorded.
+func NewCassette(path, upstream string) *Cassette {
+	return &Cassette{path: path, Upstream: upstream}
+}
+
+// add appends an interaction to the cassette file, writing the header first
+// when the file is new.
+func (c *Cassette) add(i *Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var lines []any
+	flags := os.O_WRONLY | os.O_APPEND
+	if len(c.Interactions) == 0 {
+		lines = append(lines, c)
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	lines = append(lines, i)
+
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, line := range lines {
+		if err := enc.Encode(line); err != nil {
+			return err
+		}
+	}
+	fd, err := os.OpenFile(c.path, flags, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := fd.Write(buf.Bytes()); err != nil {
+		_ = fd.Close()
+		return err
+	}
+	c.Interactions = append(c.Interactions, i)
+	return fd.Close()
+}
+
+// tokenPrefix is the path of the auth token routes, whose ids are bearer
+// credentials.
+const tokenPrefix = "/v2.2/auth/tokens"
+
+// redactTokens replaces the auth token ids found in an interaction with a
+// placeholder, the same one for each id so replayed requests still match.
+func (c *Cassette) redactTokens(i *Interaction) {
+	if !strings.HasPrefix(i.Path, tokenPrefix) {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.tokens == nil {
+		c.tokens = make(map[string]string)
+	}
+	register := func(id string) {
+		if _, ok := c.tokens[id]; id != "" && id != redacted && !ok {
+			c.tokens[id] = fmt.Sprintf("%s_TOKEN_%d", redacted, len(c.tokens)+1)
+		}
+	}
+	if id, ok := strings.CutPrefix(i.Path, tokenPrefix+"/"); ok {
+		register(id)
+	}
+	var token struct {
+		ID string `json:"id"`
+	}
+	if json.Unmarshal([]byte(i.Body), &token) == nil {
+		register(token.ID)
+	}
+
+	for id, placeholder := range c.tokens {
+		i.Path = strings.ReplaceAll(i.Path, id, placeholder)
+		i.Body = strings.ReplaceAll(i.Body, id, placeholder)
+		for _, headers := range []http.Header{i.Request, i.Response} {
+			for k, values := range headers {
+				for n, v := range values {
+					headers[k][n] = strings.ReplaceAll(v, id, placeholder)
+				}
+			}
+		}
+	}
+}
+
+// match finds the recorded interaction for a request. Interactions sharing
+// the same method, path and hash are replayed in recorded order, the last
+// one repeating once the others are used up.
+func (c *Cassette) match(method, path, hash string) *Interaction {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var candidates []*Interaction
+	for _, i := range c.Interactions {
+		if i.Method == method && i.Path == path && i.Hash == hash {
+			candidates = append(candidates, i)
+		}
+	}
+	if len(candidates) == 0 {
+		return nil
+	}
+
+	if c.next == nil {
+		c.next = make(map[string]int)
+	}
+	key := method + " " + path + " " + hash
+	n := c.next[key]
+	if n < len(candidates)-1 {
+		c.next[key] = n + 1
+	}
+	return candidates[n]
+}
+
+// fingerprint returns the sha256 of the file or location carried by a
+// processing request, the key used alongside the route to match replays.
+func fingerprint(header http.Header, body []byte) string {
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		return ""
+	}
+
+	sum := func(b []byte) string {
+		return fmt.Sprintf("%x", sha256.Sum256(b))
+	}
+
+	switch mediaType {
+	case "multipart/form-data":
+		reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err != nil {
+				return ""
+			}
+			if part.FormName() == "file" || part.FormName() == "location" {
+				content, err := io.ReadAll(part)
+				if err != nil {
+					return ""
+				}
+				return sum(content)
+			}
+		}
+	case "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			return ""
+		}
+		if location := form.Get("location"); location != "" {
+			return sum([]byte(location))
+		}
+	}
+	return ""
+}
+
+// redact strips credentials from headers and replaces every occurrence of
+// secrets in s.
+func redact(headers http.Header, s string, secrets ...string) (http.Header, string) {
+	clean := headers.Clone()
+	for _, h := range redactedHeaders {
+		if clean.Get(h) != "" {
+			clean.Set(h, redacted)
+		}
+	}
+	for _, secret := range secrets {
+		if secret == "" {
+			continue
+		}
+		s = replaceToken(s, secret, redacted)
+		for k, values := range clean {
+			for i, v := range values {
+				clean[k][i] = replaceToken(v, secret, redacted)
+			}
+		}
+	}
+	return clean, s
+}
+
+// replaceToken replaces the occurrences of token in s that are not part of
+// a longer word, so a short secret such as "key" leaves "keys" alone.
+func replaceToken(s, token, replacement string) string {
+	word := func(b byte) bool {
+		return b == '_' || b == '-' || '0' <= b && b <= '9' || 'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z'
+	}
+	var b strings.Builder
+	for {
+		n := strings.Index(s, token)
+		if n < 0 {
+			b.WriteString(s)
+			return b.String()
+		}
+		end := n + len(token)
+		if (n > 0 && word(s[n-1])) || (end < len(s) && word(s[end])) {
+			b.WriteString(s[:n+1])
+			s = s[n+1:]
+			continue
+		}
+		b.WriteString(s[:n])
+		b.WriteString(replacement)
+		s = s[end:]
+	}
+}
+
+// isAPIRequest reports whether a request targets the proxied API rather
+// than a local route such as the static samples or the spec.
+func isAPIRequest(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, "/v2.2/") && r.URL.Path != specPath
+}
+
+// Record wraps a handler so API requests are forwarded to upstream and
+// every exchange is recorded, with credentials redacted, to the cassette.
+// Local routes are served by next.
+func Record(next http.Handler, upstream string, c *Cassette) (http.Handler, error) {
+	target, err := url.Parse(upstream)
+	if err != nil {
+		return nil, fmt.Errorf("invalid upstream %q: %w", upstream, err)
+	}
+	if target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("invalid upstream %q, expected a URL such as https://api-us1.scanii.com", upstream)
+	}
+
+	proxy := &httputil.ReverseProxy{
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			r.Out.Host = target.Host
+			// let the transport negotiate compression so bodies are recorded decoded
+			r.Out.Header.Del("Accept-Encoding")
+		},
+		ErrorHandler: func(w http.ResponseWriter, _ *http.Request, err error) {
+			slog.Error("upstream request failed", "error", err)
+			_ = writeJSON(w, http.StatusBadGateway, map[string]string{"error": err.Error()}, nil)
+		},
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			_ = writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()}, nil)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		key, secret, _ := r.BasicAuth()
+
+		buffered := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		proxy.ServeHTTP(buffered, r)
+
+		requestHeaders, _ := redact(r.Header, "", key, secret)
+		responseHeaders, responseBody := redact(buffered.header, buffered.body.String(), key, secret)
+		interaction := &Interaction{
+			Method:   r.Method,
+			Path:     r.URL.Path,
+			Hash:     fingerprint(r.Header, body),
+			Request:  requestHeaders,
+			Status:   buffered.status,
+			Response: responseHeaders,
+			Body:     responseBody,
+		}
+		c.redactTokens(interaction)
+		if err := c.add(interaction); err != nil {
+			slog.Error("failed to save cassette", "path", c.path, "error", err)
+		} else {
+			slog.Debug("recorded interaction", "method", r.Method, "path", r.URL.Path, "status", buffered.status)
+		}
+
+		buffered.flush(w)
+	}), nil
+}
+
+// Replay wraps a handler so API requests are answered from the cassette
+// without any network access. Location headers pointing at the recorded
+// upstream are rewritten to baseURL. Local routes are served by next.
+func Replay(next http.Handler, c *Cassette, baseURL string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !isAPIRequest(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			_ = writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()}, nil)
+			return
+		}
+
+		hash := fingerprint(r.Header, body)
+		interaction := c.match(r.Method, r.URL.Path, hash)
+		if interaction == nil {
+			slog.Warn("no recorded interaction", "method", r.Method, "path", r.URL.Path, "hash", hash)
+			_ = writeJSON(w, http.StatusNotImplemented, map[string]string{
+				"error": fmt.Sprintf("no recorded interaction matches %s %s", r.Method, r.URL.Path),
+			}, nil)
+			return
+		}
+
+		for k, v := range interaction.Response {
+			w.Header()[k] = v
+		}
+		if location := w.Header().Get("Location"); location != "" && c.Upstream != "" {
+			w.Header().Set("Location", strings.Replace(location, strings.TrimSuffix(c.Upstream, "/"), baseURL, 1))
+		}
+		w.Header().Del("Content-Length")
+		w.WriteHeader(interaction.Status)
+		_, _ = io.WriteString(w, interaction.Body)
+	})
+}
+
+// proxyHandler wraps next in record or replay mode according to flags,
+// returning it unchanged when neither is configured.
+func proxyHandler(next http.Handler, flags *Flags) (http.Handler, error) {
+	switch {
+	case flags.Proxy != "" && flags.Replay != "":
+		return nil, errors.New("--proxy and --replay cannot be used together")
+	case flags.Proxy != "":
+		if flags.Record == "" {
+			return nil, errors.New("a cassette path is required to proxy, see --record")
+		}
+		return Record(next, flags.Proxy, NewCassette(flags.Record, flags.Proxy))
+	case flags.Replay != "":
+		c, err := LoadCassette(flags.Replay)
+		if err != nil {
+			return nil, err
+		}
+		//goland:noinspection HttpUrlsUsage
+		return Replay(next, c, "http://"+flags.Address), nil
+	case flags.Record != "":
+		return nil, errors.New("recording requires an upstream, see --proxy")
+	}
+	return next, nil
+}
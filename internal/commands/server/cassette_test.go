@@ -0,0 +1,221 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/uvasoftware/scanii-cli/internal/engine"
+)
+
+const (
+	cassetteKey    = "akk_cassette"
+	cassetteSecret = "aks_cassette_secret"
+)
+
+// roundTrip uploads content to url with the cassette credentials.
+func roundTrip(t *testing.T, url string, content []byte) (*http.Response, string) {
+	t.Helper()
+	body, contentType := multipartBody(t, nil, content)
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, url+"/v2.2/files", body)
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.SetBasicAuth(cassetteKey, cassetteSecret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(resp.Body)
+	return resp, string(raw)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	eng, err := engine.New()
+	if err != nil {
+		t.Fatalf("engine.New: %s", err)
+	}
+	upstreamMux := http.NewServeMux()
+	upstream := httptest.NewServer(upstreamMux)
+	t.Cleanup(upstream.Close)
+	Setup(upstreamMux, eng, cassetteKey, cassetteSecret, t.TempDir(), upstream.URL)
+
+	path := filepath.Join(t.TempDir(), "cassette.json")
+	recorder, err := Record(http.NotFoundHandler(), upstream.URL, NewCassette(path, upstream.URL))
+	if err != nil {
+		t.Fatalf("record: %s", err)
+	}
+	proxy := httptest.NewServer(recorder)
+	t.Cleanup(proxy.Close)
+
+	recorded, recordedBody := roundTrip(t, proxy.URL, []byte("hello cassette"))
+	if recorded.StatusCode != http.StatusCreated {
+		t.Fatalf("record status: want 201, got %d: %s", recorded.StatusCode, recordedBody)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cassette: %s", err)
+	}
+	if strings.Contains(string(raw), cassetteSecret) {
+		t.Error("cassette leaks the API secret")
+	}
+	if !strings.Contains(string(raw), redacted) {
+		t.Error("expected the authorization header to be redacted")
+	}
+
+	// replay without the upstream
+	upstream.Close()
+	c, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("load cassette: %s", err)
+	}
+	replayer := httptest.NewUnstartedServer(nil)
+	replayer.Config.Handler = Replay(http.NotFoundHandler(), c, "http://replay.example")
+	replayer.Start()
+	t.Cleanup(replayer.Close)
+
+	replayed, replayedBody := roundTrip(t, replayer.URL, []byte("hello cassette"))
+	if replayed.StatusCode != http.StatusCreated {
+		t.Fatalf("replay status: want 201, got %d: %s", replayed.StatusCode, replayedBody)
+	}
+	if replayedBody != recordedBody {
+		t.Errorf("replayed body differs:\nwant %s\ngot  %s", recordedBody, replayedBody)
+	}
+	if location := replayed.Header.Get("Location"); !strings.HasPrefix(location, "http://replay.example/") {
+		t.Errorf("location not rewritten: %s", location)
+	}
+
+	unknown, _ := roundTrip(t, replayer.URL, []byte("never recorded"))
+	if unknown.StatusCode != http.StatusNotImplemented {
+		t.Errorf("unrecorded status: want 501, got %d", unknown.StatusCode)
+	}
+}
+
+func TestCassetteMatchOrder(t *testing.T) {
+	c := &Cassette{Interactions: []*Interaction{
+		{Method: http.MethodGet, Path: "/v2.2/files/1", Status: http.StatusOK, Body: "first"},
+		{Method: http.MethodGet, Path: "/v2.2/files/1", Status: http.StatusOK, Body: "second"},
+	}}
+
+	for _, want := range []string{"first", "second", "second"} {
+		got := c.match(http.MethodGet, "/v2.2/files/1", "")
+		if got == nil || got.Body != want {
+			t.Fatalf("want %s, got %+v", want, got)
+		}
+	}
+	if c.match(http.MethodGet, "/v2.2/files/2", "") != nil {
+		t.Error("expected no match for an unrecorded path")
+	}
+}
+
+func TestProxyHandlerFlags(t *testing.T) {
+	next := http.NotFoundHandler()
+	if _, err := proxyHandler(next, &Flags{Proxy: "https://api-us1.scanii.com"}); err == nil {
+		t.Error("expected an error proxying without a cassette")
+	}
+	if _, err := proxyHandler(next, &Flags{Record: "cassette.json"}); err == nil {
+		t.Error("expected an error recording without an upstream")
+	}
+	if _, err := proxyHandler(next, &Flags{Proxy: "api-us1.scanii.com", Record: "cassette.json"}); err == nil {
+		t.Error("expected an error for an upstream without a scheme")
+	}
+	if _, err := proxyHandler(next, &Flags{Replay: filepath.Join(t.TempDir(), "missing.json")}); err == nil {
+		t.Error("expected an error replaying a missing cassette")
+	}
+}
+
+func TestRedact(t *testing.T) {
+	headers := http.Header{"Authorization": {"Basic a2V5OnNlY3JldA=="}, "X-Key": {"key"}}
+	clean, body := redact(headers, `{"key":"key","keys":"monkey key-ring"}`, "key", "secret")
+	if body != `{"REDACTED":"REDACTED","keys":"monkey key-ring"}` {
+		t.Errorf("unexpected body %s", body)
+	}
+	if clean.Get("Authorization") != redacted || clean.Get("X-Key") != redacted {
+		t.Errorf("unexpected headers %v", clean)
+	}
+	if headers.Get("X-Key") != "key" {
+		t.Error("expected the original headers to be left untouched")
+	}
+}
+
+func TestRecordRedactsAuthTokens(t *testing.T) {
+	eng, err := engine.New()
+	if err != nil {
+		t.Fatalf("engine.New: %s", err)
+	}
+	upstreamMux := http.NewServeMux()
+	upstream := httptest.NewServer(upstreamMux)
+	t.Cleanup(upstream.Close)
+	Setup(upstreamMux, eng, cassetteKey, cassetteSecret, t.TempDir(), upstream.URL)
+
+	path := filepath.Join(t.TempDir(), "cassette.ndjson")
+	recorder, err := Record(http.NotFoundHandler(), upstream.URL, NewCassette(path, upstream.URL))
+	if err != nil {
+		t.Fatalf("record: %s", err)
+	}
+	proxy := httptest.NewServer(recorder)
+	t.Cleanup(proxy.Close)
+
+	send := func(base, method, route string) (int, map[string]any) {
+		t.Helper()
+		req, err := http.NewRequestWithContext(t.Context(), method, base+route, http.NoBody)
+		if err != nil {
+			t.Fatalf("new request: %s", err)
+		}
+		req.SetBasicAuth(cassetteKey, cassetteSecret)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("%s %s: %s", method, route, err)
+		}
+		defer resp.Body.Close()
+		var body map[string]any
+		_ = json.NewDecoder(resp.Body).Decode(&body)
+		return resp.StatusCode, body
+	}
+
+	status, created := send(proxy.URL, http.MethodPost, "/v2.2/auth/tokens")
+	id, _ := created["id"].(string)
+	if status != http.StatusCreated || id == "" {
+		t.Fatalf("create token: got %d %v", status, created)
+	}
+	if status, _ := send(proxy.URL, http.MethodGet, "/v2.2/auth/tokens/"+id); status != http.StatusOK {
+		t.Fatalf("retrieve token: got %d", status)
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read cassette: %s", err)
+	}
+	if strings.Contains(string(raw), id) {
+		t.Errorf("cassette leaks the auth token %s:\n%s", id, raw)
+	}
+	// a header line and one line per interaction, appended as recorded
+	if lines := strings.Count(string(raw), "\n"); lines != 3 {
+		t.Errorf("expected 3 lines, got %d:\n%s", lines, raw)
+	}
+
+	// the placeholder handed out on replay retrieves the recorded token
+	upstream.Close()
+	c, err := LoadCassette(path)
+	if err != nil {
+		t.Fatalf("load cassette: %s", err)
+	}
+	replayer := httptest.NewServer(Replay(http.NotFoundHandler(), c, "http://replay.example"))
+	t.Cleanup(replayer.Close)
+	_, replayed := send(replayer.URL, http.MethodPost, "/v2.2/auth/tokens")
+	placeholder, _ := replayed["id"].(string)
+	if !strings.HasPrefix(placeholder, redacted) {
+		t.Fatalf("expected a placeholder id, got %v", replayed)
+	}
+	if status, _ := send(replayer.URL, http.MethodGet, "/v2.2/auth/tokens/"+placeholder); status != http.StatusOK {
+		t.Errorf("retrieve replayed token: got %d", status)
+	}
+}
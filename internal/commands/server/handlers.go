@@ -28,6 +28,7 @@ type FakeHandler struct {
 	engine  *engine.Engine
 	baseurl string
 	store   store
+	metrics *metrics
 }
 
 func (h FakeHandler) ProcessFileAsync(w http.ResponseWriter, r *http.Request) {
@@ -59,7 +60,7 @@ func (h FakeHandler) ProcessFileAsync(w http.ResponseWriter, r *http.Request) {
 			fileFound = true
 
 			// performing analysis, it has to happen while we're parsing the stream
-			result, err = h.engine.Process(part)
+			result, err = h.engine.ProcessContext(r.Context(), part)
 			if err != nil {
 				h.renderServerError(w, err.Error())
 				return
@@ -107,10 +108,11 @@ func (h FakeHandler) ProcessFileAsync(w http.ResponseWriter, r *http.Request) {
 		h.renderClientError(http.StatusBadRequest, w, errorNoFileSent)
 		return
 	}
+	h.metrics.observeResult(&result)
 
 	// sending callback if available:
 	if callback != "" {
-		h.engine.QueueCallback(callback, &result)
+		h.engine.QueueCallback(r.Context(), callback, &result)
 	}
 
 	// sending response
@@ -171,7 +173,7 @@ func (h FakeHandler) ProcessFileFetch(w http.ResponseWriter, r *http.Request) {
 
 	if httpResponse.StatusCode == http.StatusOK {
 		// performing analysis, it has to happen while we're parsing the stream
-		result, err = h.engine.Process(httpResponse.Body)
+		result, err = h.engine.ProcessContext(r.Context(), httpResponse.Body)
 		if err != nil {
 			h.renderServerError(w, err.Error())
 			return
@@ -188,10 +190,11 @@ func (h FakeHandler) ProcessFileFetch(w http.ResponseWriter, r *http.Request) {
 		h.renderServerError(w, err.Error())
 		return
 	}
+	h.metrics.observeResult(&result)
 
 	// sending callback if available:
 	if r.Form.Get("callback") != "" {
-		h.engine.QueueCallback(r.Form.Get("callback"), &result)
+		h.engine.QueueCallback(r.Context(), r.Form.Get("callback"), &result)
 	}
 
 	headers := http.Header{}
@@ -399,7 +402,7 @@ func (h FakeHandler) ProcessFile(w http.ResponseWriter, r *http.Request) {
 			fileFound = true
 
 			// performing analysis, it has to happen while we're parsing the stream
-			result, err = h.engine.Process(part)
+			result, err = h.engine.ProcessContext(r.Context(), part)
 			if err != nil {
 				h.renderServerError(w, err.Error())
 				return
@@ -442,7 +445,7 @@ func (h FakeHandler) ProcessFile(w http.ResponseWriter, r *http.Request) {
 			defer resp.Body.Close() //nolint
 			if resp.StatusCode == http.StatusOK {
 				// performing analysis, it has to happen while we're parsing the stream
-				result, err = h.engine.Process(resp.Body)
+				result, err = h.engine.ProcessContext(r.Context(), resp.Body)
 				if err != nil {
 					h.renderServerError(w, err.Error())
 					return
@@ -479,6 +482,7 @@ func (h FakeHandler) ProcessFile(w http.ResponseWriter, r *http.Request) {
 		h.renderClientError(http.StatusBadRequest, w, errorNoFileSent)
 		return
 	}
+	h.metrics.observeResult(&result)
 
 	// sending response
 	foo := client.ProcessingResponse{
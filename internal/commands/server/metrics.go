@@ -0,0 +1,186 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/uvasoftware/scanii-cli/internal/engine"
+)
+
+// latencyBuckets mirrors the Prometheus client default histogram buckets, in seconds.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type requestKey struct {
+	route  string
+	status int
+}
+
+type requestStats struct {
+	count   uint64
+	sum     float64
+	buckets []uint64
+}
+
+// metrics collects server statistics and renders them in the Prometheus
+// text exposition format. Engine and store figures are read at scrape time.
+type metrics struct {
+	mu             sync.Mutex
+	requests       map[requestKey]*requestStats
+	findings       map[string]uint64
+	bytesProcessed atomic.Uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[requestKey]*requestStats),
+		findings: make(map[string]uint64),
+	}
+}
+
+// statusRecorder captures the status code written by a handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// instrument wraps a handler so its requests are counted and timed under route.
+func (m *metrics) instrument(route string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		m.observeRequest(route, rec.status, time.Since(start))
+	})
+}
+
+func (m *metrics) observeRequest(route string, status int, elapsed time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := requestKey{route: route, status: status}
+	stats, ok := m.requests[key]
+	if !ok {
+		stats = &requestStats{buckets: make([]uint64, len(latencyBuckets))}
+		m.requests[key] = stats
+	}
+	seconds := elapsed.Seconds()
+	stats.count++
+	stats.sum += seconds
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			stats.buckets[i]++
+		}
+	}
+}
+
+// observeResult records the bytes and findings of a processed result.
+func (m *metrics) observeResult(result *engine.Result) {
+	m.bytesProcessed.Add(result.ContentLength)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, f := range result.Findings {
+		m.findings[f]++
+	}
+}
+
+// handler serves the collected metrics.
+func (m *metrics) handler(eng *engine.Engine, s store) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		m.write(w, eng, s)
+	}
+}
+
+func (m *metrics) write(w io.Writer, eng *engine.Engine, s store) {
+	m.mu.Lock()
+	keys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].route != keys[j].route {
+			return keys[i].route < keys[j].route
+		}
+		return keys[i].status < keys[j].status
+	})
+
+	header(w, "scanii_http_requests_total", "counter", "Requests served by route and status code.")
+	for _, k := range keys {
+		fmt.Fprintf(w, "scanii_http_requests_total%s %d\n", labels("route", k.route, "status", strconv.Itoa(k.status)), m.requests[k].count)
+	}
+
+	header(w, "scanii_http_request_duration_seconds", "histogram", "Request latency by route and status code.")
+	for _, k := range keys {
+		stats := m.requests[k]
+		status := strconv.Itoa(k.status)
+		for i, le := range latencyBuckets {
+			fmt.Fprintf(w, "scanii_http_request_duration_seconds_bucket%s %d\n", labels("route", k.route, "status", status, "le", formatFloat(le)), stats.buckets[i])
+		}
+		fmt.Fprintf(w, "scanii_http_request_duration_seconds_bucket%s %d\n", labels("route", k.route, "status", status, "le", "+Inf"), stats.count)
+		fmt.Fprintf(w, "scanii_http_request_duration_seconds_sum%s %s\n", labels("route", k.route, "status", status), formatFloat(stats.sum))
+		fmt.Fprintf(w, "scanii_http_request_duration_seconds_count%s %d\n", labels("route", k.route, "status", status), stats.count)
+	}
+
+	findings := make([]string, 0, len(m.findings))
+	for f := range m.findings {
+		findings = append(findings, f)
+	}
+	sort.Strings(findings)
+	header(w, "scanii_findings_total", "counter", "Findings reported by finding type.")
+	for _, f := range findings {
+		fmt.Fprintf(w, "scanii_findings_total%s %d\n", labels("finding", f), m.findings[f])
+	}
+	m.mu.Unlock()
+
+	header(w, "scanii_processed_bytes_total", "counter", "Bytes of content processed.")
+	fmt.Fprintf(w, "scanii_processed_bytes_total %d\n", m.bytesProcessed.Load())
+
+	delivered, failed := eng.CallbackStats()
+	header(w, "scanii_callbacks_delivered_total", "counter", "Callbacks delivered successfully.")
+	fmt.Fprintf(w, "scanii_callbacks_delivered_total %d\n", delivered)
+	header(w, "scanii_callbacks_failed_total", "counter", "Callbacks that could not be delivered.")
+	fmt.Fprintf(w, "scanii_callbacks_failed_total %d\n", failed)
+
+	objects, size := s.size()
+	header(w, "scanii_store_objects", "gauge", "Objects held in the result store.")
+	fmt.Fprintf(w, "scanii_store_objects %d\n", objects)
+	header(w, "scanii_store_bytes", "gauge", "Bytes held in the result store.")
+	fmt.Fprintf(w, "scanii_store_bytes %d\n", size)
+
+	header(w, "scanii_rule_hits_total", "counter", "Engine rule matches by rule.")
+	for _, hit := range eng.RuleHits() {
+		fmt.Fprintf(w, "scanii_rule_hits_total%s %d\n", labels("format", hit.Format, "content", hit.Content, "result", hit.Result), hit.Hits)
+	}
+}
+
+func header(w io.Writer, name, kind, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// labels renders name/value pairs as a Prometheus label set.
+func labels(pairs ...string) string {
+	escaper := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, pairs[i], escaper.Replace(pairs[i+1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
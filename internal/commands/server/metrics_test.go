@@ -0,0 +1,104 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/uvasoftware/scanii-cli/assets"
+	"github.com/uvasoftware/scanii-cli/internal/engine"
+)
+
+func TestMetrics(t *testing.T) {
+	ts := startServer(t)
+
+	body, ctype := multipartBody(t, nil, []byte(assets.DecodedEICAR()))
+	resp, err := http.DefaultClient.Do(authReq(t, ts.URL+"/v2.2/files", body, ctype))
+	if err != nil {
+		t.Fatalf("process: %s", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		t.Fatalf("process status: want 201, got %d", resp.StatusCode)
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, ts.URL+"/metrics", http.NoBody)
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+	metricsResp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("metrics: %s", err)
+	}
+	defer metricsResp.Body.Close()
+	if metricsResp.StatusCode != http.StatusOK {
+		t.Fatalf("metrics status: want 200, got %d", metricsResp.StatusCode)
+	}
+	raw, err := io.ReadAll(metricsResp.Body)
+	if err != nil {
+		t.Fatalf("read metrics: %s", err)
+	}
+	text := string(raw)
+
+	for _, want := range []string{
+		`scanii_http_requests_total{route="POST /v2.2/files",status="201"} 1`,
+		`scanii_http_request_duration_seconds_count{route="POST /v2.2/files",status="201"} 1`,
+		`scanii_findings_total{finding="content.malicious.eicar-test-signature"} 1`,
+		`scanii_processed_bytes_total 68`,
+		`scanii_store_objects 1`,
+		`scanii_callbacks_failed_total 0`,
+		`scanii_rule_hits_total{format="sha1",content="3395856ce81f2b7382dee72602f798b642f14140",result="content.malicious.eicar-test-signature"} 1`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Errorf("metrics missing %q\n%s", want, text)
+		}
+	}
+}
+
+func TestMetricsSkipRejectedUploads(t *testing.T) {
+	eng, err := engine.New()
+	if err != nil {
+		t.Fatalf("engine.New: %s", err)
+	}
+	// empty content would be reported with a finding if it were observed
+	eng.AddRule(engine.Rule{Format: "sha1", Content: "da39a3ee5e6b4b0d3255bfef95601890afd80709", Result: "content.empty"})
+	mux := http.NewServeMux()
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	Setup(mux, eng, "key", "secret", t.TempDir(), ts.URL)
+
+	for _, path := range []string{"/v2.2/files", "/v2.2/files/async"} {
+		body, ctype := multipartBody(t, nil, []byte{})
+		resp, err := http.DefaultClient.Do(authReq(t, ts.URL+path, body, ctype))
+		if err != nil {
+			t.Fatalf("process: %s", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusBadRequest {
+			t.Fatalf("%s status: want 400, got %d", path, resp.StatusCode)
+		}
+	}
+
+	resp, err := http.Get(ts.URL + "/metrics") //nolint:noctx
+	if err != nil {
+		t.Fatalf("metrics: %s", err)
+	}
+	defer resp.Body.Close()
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("read metrics: %s", err)
+	}
+	if strings.Contains(string(raw), `scanii_findings_total{finding="content.empty"}`) {
+		t.Errorf("expected rejected uploads not to be counted\n%s", raw)
+	}
+}
+
+func TestLabelsEscaping(t *testing.T) {
+	got := labels("a", `x"y`, "b", `back\slash`)
+	want := `{a="x\"y",b="back\\slash"}`
+	if got != want {
+		t.Fatalf("want %s, got %s", want, got)
+	}
+}
@@ -0,0 +1,182 @@
+package server
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+)
+
+// specPath is the well-known route the OpenAPI document is served from.
+const specPath = "/v2.2/openapi.yaml"
+
+//go:embed openapi.yaml
+var openAPISpec []byte
+
+// StrictMode controls how requests and responses are checked against the
+// embedded OpenAPI document.
+type StrictMode string
+
+const (
+	// StrictOff disables validation.
+	StrictOff StrictMode = ""
+	// StrictLog logs violations but serves requests unchanged.
+	StrictLog StrictMode = "log"
+	// StrictEnforce rejects invalid requests with 400 and replaces invalid
+	// responses with 500, in both cases describing the violation.
+	StrictEnforce StrictMode = "enforce"
+)
+
+// ParseStrictMode validates a strict mode flag value.
+func ParseStrictMode(s string) (StrictMode, error) {
+	switch m := StrictMode(s); m {
+	case StrictOff, StrictLog, StrictEnforce:
+		return m, nil
+	}
+	return StrictOff, fmt.Errorf("invalid strict mode %q, expected %q or %q", s, StrictLog, StrictEnforce)
+}
+
+func init() {
+	// the stock decoder reports optional fields missing from the form as
+	// null, which then fails validation against non-nullable schemas
+	openapi3filter.RegisterBodyDecoder("application/x-www-form-urlencoded", func(body io.Reader, header http.Header, schema *openapi3.SchemaRef, encFn openapi3filter.EncodingFn) (any, error) {
+		value, err := openapi3filter.UrlencodedBodyDecoder(body, header, schema, encFn)
+		if obj, ok := value.(map[string]any); ok {
+			for k, v := range obj {
+				if v == nil {
+					delete(obj, k)
+				}
+			}
+		}
+		return value, err
+	})
+}
+
+func serveSpec(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/yaml")
+	_, _ = w.Write(openAPISpec)
+}
+
+// loadSpec parses the embedded OpenAPI document and builds a router for it.
+// Servers are replaced with a relative one so requests match on any host.
+func loadSpec() (routers.Router, error) {
+	loader := openapi3.NewLoader()
+	doc, err := loader.LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi spec: %w", err)
+	}
+	if err := doc.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid openapi spec: %w", err)
+	}
+	doc.Servers = openapi3.Servers{{URL: "/v2.2"}}
+	return gorillamux.NewRouter(doc)
+}
+
+// bufferedResponse holds a handler's response so it can be validated
+// before being sent.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (b *bufferedResponse) Header() http.Header         { return b.header }
+func (b *bufferedResponse) Write(p []byte) (int, error) { return b.body.Write(p) }
+func (b *bufferedResponse) WriteHeader(status int)      { b.status = status }
+
+func (b *bufferedResponse) flush(w http.ResponseWriter) {
+	for k, v := range b.header {
+		w.Header()[k] = v
+	}
+	w.WriteHeader(b.status)
+	_, _ = w.Write(b.body.Bytes())
+}
+
+// Strict wraps a handler so API requests and responses are validated
+// against the embedded OpenAPI document. Routes the document does not
+// describe, such as static files, pass through unchecked.
+func Strict(next http.Handler, mode StrictMode) (http.Handler, error) {
+	if mode == StrictOff {
+		return next, nil
+	}
+
+	router, err := loadSpec()
+	if err != nil {
+		return nil, err
+	}
+
+	options := &openapi3filter.Options{
+		AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+		IncludeResponseStatus: true,
+		MultiError:            true,
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := router.FindRoute(r)
+		if err != nil {
+			if !errors.Is(err, routers.ErrPathNotFound) && !errors.Is(err, routers.ErrMethodNotAllowed) {
+				slog.Warn("could not match request against openapi spec", "path", r.URL.Path, "error", err)
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// the body is consumed by validation so it's buffered and replayed
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		requestInput := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options:    options,
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), requestInput); err != nil {
+			slog.Warn("request violates openapi spec", "method", r.Method, "path", r.URL.Path, "error", err)
+			if mode == StrictEnforce {
+				renderViolation(w, http.StatusBadRequest, "request", err)
+				return
+			}
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+
+		buffered := &bufferedResponse{header: http.Header{}, status: http.StatusOK}
+		next.ServeHTTP(buffered, r)
+
+		responseInput := &openapi3filter.ResponseValidationInput{
+			RequestValidationInput: requestInput,
+			Status:                 buffered.status,
+			Header:                 buffered.header,
+			Options:                options,
+		}
+		responseInput.SetBodyBytes(buffered.body.Bytes())
+		if err := openapi3filter.ValidateResponse(r.Context(), responseInput); err != nil {
+			slog.Warn("response violates openapi spec", "method", r.Method, "path", r.URL.Path, "status", buffered.status, "error", err)
+			if mode == StrictEnforce {
+				renderViolation(w, http.StatusInternalServerError, "response", err)
+				return
+			}
+		}
+
+		buffered.flush(w)
+	}), nil
+}
+
+func renderViolation(w http.ResponseWriter, status int, direction string, violation error) {
+	message := fmt.Sprintf("%s does not match the API specification: %s", direction, violation)
+	if err := writeJSON(w, status, map[string]string{"error": message}, nil); err != nil {
+		slog.Error("failed to write violation", "error", err)
+	}
+}
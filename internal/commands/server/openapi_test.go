@@ -0,0 +1,192 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/uvasoftware/scanii-cli/assets"
+	"github.com/uvasoftware/scanii-cli/internal/engine"
+)
+
+// startStrictServer starts a server that enforces the OpenAPI spec.
+func startStrictServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	eng, err := engine.New()
+	if err != nil {
+		t.Fatalf("engine.New: %s", err)
+	}
+	mux := http.NewServeMux()
+	handler, err := Strict(mux, StrictEnforce)
+	if err != nil {
+		t.Fatalf("strict: %s", err)
+	}
+	ts := httptest.NewServer(CORS(handler))
+	t.Cleanup(ts.Close)
+	Setup(mux, eng, "key", "secret", t.TempDir(), ts.URL)
+	return ts
+}
+
+func getAuth(t *testing.T, url string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, url, http.NoBody)
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+	req.SetBasicAuth("key", "secret")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("get %s: %s", url, err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+func TestServeSpec(t *testing.T) {
+	ts := startServer(t)
+
+	resp, err := http.Get(ts.URL + specPath) //nolint:noctx
+	if err != nil {
+		t.Fatalf("get spec: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status: want 200, got %d", resp.StatusCode)
+	}
+	raw, _ := io.ReadAll(resp.Body)
+	if !strings.Contains(string(raw), "openapi: 3.0.3") {
+		t.Fatalf("expected an openapi document, got %s", raw)
+	}
+}
+
+func TestParseStrictMode(t *testing.T) {
+	for _, valid := range []string{"", "log", "enforce"} {
+		if _, err := ParseStrictMode(valid); err != nil {
+			t.Errorf("%q: unexpected error %s", valid, err)
+		}
+	}
+	if _, err := ParseStrictMode("nope"); err == nil {
+		t.Error("expected error for invalid mode")
+	}
+}
+
+// TestStrictConformingTraffic verifies the mock's own responses pass
+// enforcement across the API surface.
+func TestStrictConformingTraffic(t *testing.T) {
+	ts := startStrictServer(t)
+
+	if resp := getAuth(t, ts.URL+"/v2.2/ping"); resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		t.Fatalf("ping: want 200, got %d: %s", resp.StatusCode, raw)
+	}
+	if resp := getAuth(t, ts.URL+"/v2.2/account.json"); resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		t.Fatalf("account: want 200, got %d: %s", resp.StatusCode, raw)
+	}
+
+	body, ctype := multipartBody(t, map[string]string{"metadata[m1]": "v1"}, []byte(assets.DecodedEICAR()))
+	resp, err := http.DefaultClient.Do(authReq(t, ts.URL+"/v2.2/files", body, ctype))
+	if err != nil {
+		t.Fatalf("process: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		raw, _ := io.ReadAll(resp.Body)
+		t.Fatalf("process: want 201, got %d: %s", resp.StatusCode, raw)
+	}
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+
+	if resp := getAuth(t, ts.URL+"/v2.2/files/"+created.ID); resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		t.Fatalf("retrieve: want 200, got %d: %s", resp.StatusCode, raw)
+	}
+	if resp := getAuth(t, ts.URL+"/v2.2/files/"+created.ID+"/trace"); resp.StatusCode != http.StatusOK {
+		raw, _ := io.ReadAll(resp.Body)
+		t.Fatalf("trace: want 200, got %d: %s", resp.StatusCode, raw)
+	}
+	if resp := getAuth(t, ts.URL+"/v2.2/files/doesnotexist"); resp.StatusCode != http.StatusNotFound {
+		raw, _ := io.ReadAll(resp.Body)
+		t.Fatalf("retrieve unknown: want 404, got %d: %s", resp.StatusCode, raw)
+	}
+
+	form := url.Values{"location": {ts.URL + "/static/eicar.txt"}, "metadata[m1]": {"v1"}}
+	fetch, err := http.DefaultClient.Do(authReq(t, ts.URL+"/v2.2/files/fetch", strings.NewReader(form.Encode()), "application/x-www-form-urlencoded"))
+	if err != nil {
+		t.Fatalf("fetch: %s", err)
+	}
+	defer fetch.Body.Close()
+	if fetch.StatusCode != http.StatusAccepted {
+		raw, _ := io.ReadAll(fetch.Body)
+		t.Fatalf("fetch: want 202, got %d: %s", fetch.StatusCode, raw)
+	}
+
+	token, err := http.DefaultClient.Do(authReq(t, ts.URL+"/v2.2/auth/tokens", strings.NewReader("timeout=60"), "application/x-www-form-urlencoded"))
+	if err != nil {
+		t.Fatalf("create token: %s", err)
+	}
+	defer token.Body.Close()
+	if token.StatusCode != http.StatusCreated {
+		raw, _ := io.ReadAll(token.Body)
+		t.Fatalf("create token: want 201, got %d: %s", token.StatusCode, raw)
+	}
+}
+
+func TestStrictRejectsInvalidRequest(t *testing.T) {
+	ts := startStrictServer(t)
+
+	// location is required by the spec
+	resp, err := http.DefaultClient.Do(authReq(t, ts.URL+"/v2.2/files/fetch", strings.NewReader("callback=https://example.com"), "application/x-www-form-urlencoded"))
+	if err != nil {
+		t.Fatalf("fetch: %s", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("status: want 400, got %d", resp.StatusCode)
+	}
+	var errResp struct {
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+	if !strings.Contains(errResp.Error, "request does not match the API specification") {
+		t.Fatalf("unexpected error message: %s", errResp.Error)
+	}
+}
+
+func TestStrictRejectsInvalidResponse(t *testing.T) {
+	// a ping response missing the required message field
+	bad := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		_ = writeJSON(w, http.StatusOK, map[string]string{"key": "key"}, nil)
+	})
+
+	for _, tc := range []struct {
+		mode StrictMode
+		want int
+	}{
+		{StrictLog, http.StatusOK},
+		{StrictEnforce, http.StatusInternalServerError},
+	} {
+		t.Run(string(tc.mode), func(t *testing.T) {
+			handler, err := Strict(bad, tc.mode)
+			if err != nil {
+				t.Fatalf("strict: %s", err)
+			}
+			ts := httptest.NewServer(handler)
+			t.Cleanup(ts.Close)
+
+			if resp := getAuth(t, ts.URL+"/v2.2/ping"); resp.StatusCode != tc.want {
+				t.Fatalf("status: want %d, got %d", tc.want, resp.StatusCode)
+			}
+		})
+	}
+}
@@ -53,6 +53,7 @@ func Setup(mux *http.ServeMux, eng *engine.Engine, key, secret, data, baseURL st
 		engine:  eng,
 		store:   store{path: data},
 		baseurl: baseURL,
+		metrics: newMetrics(),
 	}
 
 	hostID := "hst_" + identifiers.GenerateShort()
@@ -113,14 +114,20 @@ func Setup(mux *http.ServeMux, eng *engine.Engine, key, secret, data, baseURL st
 		return middleware(h, authMiddleware, headersMiddleware)
 	}
 
+	// handle registers a route, recording its requests in the server
+	// metrics and tracing them.
+	handle := func(pattern string, h http.Handler) {
+		mux.Handle(pattern, handlers.metrics.instrument(pattern, traced(pattern, h)))
+	}
+
 	// Static fixtures (unauthenticated) — used both by the CLI demo and
 	// by integration tests that fetch via the server's own URL.
-	mux.HandleFunc("GET /static/eicar.txt", serverEICAR)
+	handle("GET /static/eicar.txt", http.HandlerFunc(serverEICAR))
 	fileServer := http.FileServer(http.FS(assets.EmbeddedFiles))
-	mux.Handle("GET /static/", http.StripPrefix("/static/", fileServer))
+	handle("GET /static/", http.StripPrefix("/static/", fileServer))
 
 	// healthcheck route used by the docker container:
-	mux.Handle("GET /healthcheck", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+	handle("GET /healthcheck", http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
 		writer.WriteHeader(http.StatusOK)
 		_, err := io.WriteString(writer, "UP")
 		if err != nil {
@@ -128,23 +135,29 @@ func Setup(mux *http.ServeMux, eng *engine.Engine, key, secret, data, baseURL st
 		}
 	}))
 
-	mux.Handle("GET /v2.2/account.json", wrap(handlers.Account))
-	mux.Handle("GET /v2.2/ping", wrap(handlers.Ping))
-	mux.Handle("POST /v2.2/files/async", wrap(handlers.ProcessFileAsync))
-	mux.Handle("POST /v2.2/files/fetch", wrap(handlers.ProcessFileFetch))
-	mux.Handle("POST /v2.2/files", wrap(handlers.ProcessFile))
-	mux.Handle("GET /v2.2/files/{id}/trace", wrap(func(w http.ResponseWriter, r *http.Request) {
+	// the API contract this server implements (unauthenticated):
+	handle("GET "+specPath, http.HandlerFunc(serveSpec))
+
+	// Prometheus scrape target (unauthenticated, like the healthcheck):
+	mux.Handle("GET /metrics", handlers.metrics.handler(eng, handlers.store))
+
+	handle("GET /v2.2/account.json", wrap(handlers.Account))
+	handle("GET /v2.2/ping", wrap(handlers.Ping))
+	handle("POST /v2.2/files/async", wrap(handlers.ProcessFileAsync))
+	handle("POST /v2.2/files/fetch", wrap(handlers.ProcessFileFetch))
+	handle("POST /v2.2/files", wrap(handlers.ProcessFile))
+	handle("GET /v2.2/files/{id}/trace", wrap(func(w http.ResponseWriter, r *http.Request) {
 		handlers.RetrieveTrace(w, r, r.PathValue("id"))
 	}))
-	mux.Handle("GET /v2.2/files/{id}", wrap(func(w http.ResponseWriter, r *http.Request) {
+	handle("GET /v2.2/files/{id}", wrap(func(w http.ResponseWriter, r *http.Request) {
 		handlers.RetrieveFile(w, r, r.PathValue("id"))
 	}))
 
-	mux.Handle("POST /v2.2/auth/tokens", wrap(handlers.CreateToken))
-	mux.Handle("GET /v2.2/auth/tokens/{id}", wrap(func(w http.ResponseWriter, r *http.Request) {
+	handle("POST /v2.2/auth/tokens", wrap(handlers.CreateToken))
+	handle("GET /v2.2/auth/tokens/{id}", wrap(func(w http.ResponseWriter, r *http.Request) {
 		handlers.RetrieveToken(w, r, r.PathValue("id"))
 	}))
-	mux.Handle("DELETE /v2.2/auth/tokens/{id}", wrap(func(w http.ResponseWriter, r *http.Request) {
+	handle("DELETE /v2.2/auth/tokens/{id}", wrap(func(w http.ResponseWriter, r *http.Request) {
 		handlers.DeleteToken(w, r, r.PathValue("id"))
 	}))
 }
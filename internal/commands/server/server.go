@@ -27,6 +27,10 @@ type Flags struct {
 	Data         string
 	ReadyChan    chan bool
 	CallBackWait time.Duration
+	Strict       string
+	Proxy        string
+	Record       string
+	Replay       string
 }
 
 // RunServer starts the mock Scanii server. This function blocks.
@@ -61,6 +65,12 @@ func RunServer(flags *Flags) {
 		}
 	}
 
+	strict, err := ParseStrictMode(flags.Strict)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+
 	mux := http.NewServeMux()
 
 	eng, err := engine.New()
@@ -79,7 +89,17 @@ func RunServer(flags *Flags) {
 		MessageFieldName: "message",
 		TimeFieldFormat:  time.DateTime,
 	})
-	handler := CORS(httplog.RequestLogger(logger)(mux))
+	proxied, err := proxyHandler(mux, flags)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	validated, err := Strict(proxied, strict)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(2)
+	}
+	handler := CORS(httplog.RequestLogger(logger)(validated))
 
 	srv := &http.Server{
 		Addr:         flags.Address,
@@ -98,6 +118,19 @@ func RunServer(flags *Flags) {
 	//goland:noinspection HttpUrlsUsage
 	terminal.KeyValue("Address:", fmt.Sprintf("http://%s", flags.Address))
 	//goland:noinspection HttpUrlsUsage
+	terminal.KeyValue("Metrics:", fmt.Sprintf("http://%s/metrics", flags.Address))
+	//goland:noinspection HttpUrlsUsage
+	terminal.KeyValue("OpenAPI:", fmt.Sprintf("http://%s%s", flags.Address, specPath))
+	if strict != StrictOff {
+		terminal.KeyValue("Strict mode:", string(strict))
+	}
+	if flags.Proxy != "" {
+		terminal.KeyValue("Recording:", fmt.Sprintf("%s -> %s", flags.Proxy, flags.Record))
+	}
+	if flags.Replay != "" {
+		terminal.KeyValue("Replaying:", flags.Replay)
+	}
+	//goland:noinspection HttpUrlsUsage
 	fmt.Println()
 	terminal.Info(fmt.Sprintf("Sample usage: curl -u %s:%s http://%s/v2.2/ping", flags.Key, flags.Secret, flags.Address))
 	terminal.Section("We also provide fake sample files you can use to trigger findings:")
@@ -150,6 +183,12 @@ func Command() *cobra.Command {
 	serverCmd.PersistentFlags().StringVarP(&serverF.Data, "data", "d", "", "Result storage path, defaults to a temp directory")
 	serverCmd.PersistentFlags().StringVarP(&serverF.Key, "key", "k", "key", "API key to use, if not provided will be dynamically generated")
 	serverCmd.PersistentFlags().StringVarP(&serverF.Secret, "secret", "s", "secret", "API secret to use, if not provided will be dynamically generated")
+	serverCmd.PersistentFlags().StringVar(&serverF.Strict, "strict", "", "Validate requests and responses against the OpenAPI spec, either log or enforce")
+	serverCmd.PersistentFlags().StringVar(&serverF.Proxy, "proxy", "", "Forward API requests to this upstream, such as https://api-us1.scanii.com, recording them with --record")
+	serverCmd.PersistentFlags().StringVar(&serverF.Record, "record", "", "Cassette file proxied interactions are recorded to")
+	serverCmd.PersistentFlags().StringVar(&serverF.Replay, "replay", "", "Cassette file to serve recorded interactions from, without network access")
+	serverCmd.MarkFlagsMutuallyExclusive("proxy", "replay")
+	serverCmd.MarkFlagsRequiredTogether("proxy", "record")
 
 	return serverCmd
 }
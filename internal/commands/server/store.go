@@ -8,6 +8,8 @@ import (
 	"os"
 	"path/filepath"
 	"reflect"
+
+	"github.com/uvasoftware/scanii-cli/internal/engine"
 )
 
 type store struct {
@@ -64,3 +66,32 @@ func (s store) remove(key string) (bool, error) {
 	}
 	return true, nil
 }
+
+// LoadResult reads a processing result previously saved to the data directory.
+func LoadResult(data, id string) (*engine.Result, error) {
+	result := &engine.Result{}
+	if err := (store{path: data}).load(id, result); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// size returns the number of objects in the store and their combined size.
+func (s store) size() (objects int, bytes int64) {
+	entries, err := os.ReadDir(s.path)
+	if err != nil {
+		return 0, 0
+	}
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		objects++
+		bytes += info.Size()
+	}
+	return objects, bytes
+}
@@ -4,14 +4,21 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type callbackItem struct {
 	result      *Result
 	destination string
+	spanContext trace.SpanContext
 }
 
 type callback struct {
@@ -27,8 +34,6 @@ type callback struct {
 
 // newRunner creates a new runner returning a channel to submit callbacks to
 func (e *Engine) newRunner() chan callbackItem {
-	const UA = "scanii/jackfruit (see https://www.scanii.com)"
-
 	queue := make(chan callbackItem, 100)
 	wait := time.Duration(0)
 	if e.config.CallbackWait != nil {
@@ -43,35 +48,64 @@ func (e *Engine) newRunner() chan callbackItem {
 			time.Sleep(wait)
 			slog.Debug("post wait", "destination", msg.destination)
 
-			body, err := json.Marshal(&callback{
-				ID:            msg.result.ID,
-				ContentLength: msg.result.ContentLength,
-				ContentType:   msg.result.ContentType,
-				Checksum:      msg.result.Sha1,
-				Findings:      msg.result.Findings,
-				CreationDate:  msg.result.CreationDate,
-				Metadata:      msg.result.Metadata,
-				Error:         msg.result.Error,
-			})
-			if err != nil {
-				slog.Error("failed to marshal callback", "error", err)
-				return
+			if err := e.deliver(client, msg); err != nil {
+				slog.Debug("callback failed", "destination", msg.destination, "error", err)
+				e.callbacksFailed.Add(1)
+				continue
 			}
-			req, err := http.NewRequestWithContext(context.Background(), http.MethodPost, msg.destination, bytes.NewReader(body))
-			if err != nil {
-				slog.Error("failed to create request", "error", err)
-				return
-			}
-			req.Header.Set("Content-Type", "application/json")
-			req.Header.Set("User-Agent", UA)
-
-			resp, err := client.Do(req)
-			if err != nil {
-				return
-			}
-			resp.Body.Close()
-			slog.Debug("callback delivered", "destination", msg.destination, "status", resp.StatusCode)
+			e.callbacksDelivered.Add(1)
 		}
 	}()
 	return queue
 }
+
+// deliver posts a single callback, tracing it as a child of the span that queued it.
+func (e *Engine) deliver(client *http.Client, msg callbackItem) (err error) {
+	const UA = "scanii/jackfruit (see https://www.scanii.com)"
+
+	ctx := trace.ContextWithSpanContext(context.Background(), msg.spanContext)
+	ctx, span := tracer.Start(ctx, "engine.callback", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("callback.destination", msg.destination), attribute.String("scanii.id", msg.result.ID)))
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	body, err := json.Marshal(&callback{
+		ID:            msg.result.ID,
+		ContentLength: msg.result.ContentLength,
+		ContentType:   msg.result.ContentType,
+		Checksum:      msg.result.Sha1,
+		Findings:      msg.result.Findings,
+		CreationDate:  msg.result.CreationDate,
+		Metadata:      msg.result.Metadata,
+		Error:         msg.result.Error,
+	})
+	if err != nil {
+		slog.Error("failed to marshal callback", "error", err)
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, msg.destination, bytes.NewReader(body))
+	if err != nil {
+		slog.Error("failed to create request", "error", err)
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", UA)
+	propagation.TraceContext{}.Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("callback rejected with status code %d", resp.StatusCode)
+	}
+	slog.Debug("callback delivered", "destination", msg.destination, "status", resp.StatusCode)
+	return nil
+}
@@ -2,6 +2,7 @@ package engine
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha1" //nolint want "crypto/sha1 is not recommended"[:<gosec>]
 	"crypto/sha256"
 	_ "embed"
@@ -10,17 +11,30 @@ import (
 	"io"
 	"log/slog"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/uvasoftware/scanii-cli/internal/engine")
+
 //go:embed default.json
 var defaultConfig string
 
 type Engine struct {
+	mu            sync.RWMutex
 	config        *Config
+	ruleHits      map[Rule]*atomic.Uint64
 	callbackQueue chan callbackItem
+
+	callbacksDelivered atomic.Uint64
+	callbacksFailed    atomic.Uint64
 }
 
 type Rule struct {
@@ -52,20 +66,78 @@ func New() (*Engine, error) {
 }
 
 func (e *Engine) LoadConfig(reader io.Reader) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	decoder := json.NewDecoder(reader)
 	decoder.DisallowUnknownFields()
 	err := decoder.Decode(e.config)
 	if err != nil {
 		return err
 	}
+	for _, rule := range e.config.Rules {
+		e.trackRule(rule)
+	}
 	return nil
 }
 
+// trackRule registers a hit counter for rule, callers must hold the write lock.
+func (e *Engine) trackRule(rule Rule) {
+	if e.ruleHits == nil {
+		e.ruleHits = make(map[Rule]*atomic.Uint64)
+	}
+	if _, ok := e.ruleHits[rule]; !ok {
+		e.ruleHits[rule] = &atomic.Uint64{}
+	}
+}
+
 func (e *Engine) RuleCount() int {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 	return len(e.config.Rules)
 
 }
 
+// AddRule appends a rule to the running engine, it is safe to call while
+// content is being processed.
+func (e *Engine) AddRule(rule Rule) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.config.Rules = append(e.config.Rules, rule)
+	e.trackRule(rule)
+}
+
+// RuleHit is a rule along with the number of times it matched content.
+type RuleHit struct {
+	Rule
+	Hits uint64
+}
+
+// RuleHits returns how many times each configured rule matched, in rule order.
+func (e *Engine) RuleHits() []RuleHit {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	hits := make([]RuleHit, 0, len(e.config.Rules))
+	seen := make(map[Rule]bool, len(e.config.Rules))
+	for _, rule := range e.config.Rules {
+		if seen[rule] {
+			continue
+		}
+		seen[rule] = true
+		hit := RuleHit{Rule: rule}
+		if counter := e.ruleHits[rule]; counter != nil {
+			hit.Hits = counter.Load()
+		}
+		hits = append(hits, hit)
+	}
+	return hits
+}
+
+// CallbackStats returns the number of callbacks delivered and the number
+// that failed, either at the transport level or with a non 2xx status.
+func (e *Engine) CallbackStats() (delivered, failed uint64) {
+	return e.callbacksDelivered.Load(), e.callbacksFailed.Load()
+}
+
 type Result struct {
 	ID            string
 	Sha1          string
@@ -79,7 +151,26 @@ type Result struct {
 }
 
 func (e *Engine) Process(contents io.Reader) (Result, error) {
-	result := Result{
+	return e.ProcessContext(context.Background(), contents)
+}
+
+// ProcessContext is Process with a context used to trace the analysis.
+func (e *Engine) ProcessContext(ctx context.Context, contents io.Reader) (result Result, err error) {
+	_, span := tracer.Start(ctx, "engine.process")
+	defer func() {
+		span.SetAttributes(
+			attribute.Int64("content.length", int64(result.ContentLength)), //nolint:gosec
+			attribute.String("content.type", result.ContentType),
+			attribute.Int("findings.count", len(result.Findings)),
+		)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	result = Result{
 		CreationDate: time.Now().UTC().Format(time.RFC3339Nano),
 	}
 
@@ -115,15 +206,20 @@ func (e *Engine) Process(contents io.Reader) (Result, error) {
 	}
 
 	// looking for matches in the rules:
+	e.mu.RLock()
+	defer e.mu.RUnlock()
 	for _, rule := range e.config.Rules {
+		matched := false
 		switch rule.Format {
 		case "sha1":
-			if result.Sha1 == rule.Content {
-				result.Findings = appendIfMissing(result.Findings, rule.Result)
-			}
+			matched = result.Sha1 == rule.Content
 		case "sha256":
-			if result.Sha256 == rule.Content {
-				result.Findings = appendIfMissing(result.Findings, rule.Result)
+			matched = result.Sha256 == rule.Content
+		}
+		if matched {
+			result.Findings = appendIfMissing(result.Findings, rule.Result)
+			if counter := e.ruleHits[rule]; counter != nil {
+				counter.Add(1)
 			}
 		}
 	}
@@ -132,13 +228,21 @@ func (e *Engine) Process(contents io.Reader) (Result, error) {
 
 }
 
-func (e *Engine) QueueCallback(c string, r *Result) {
+// QueueCallback schedules delivery of r to c, the span in ctx (if any)
+// becomes the parent of the delivery span.
+func (e *Engine) QueueCallback(ctx context.Context, c string, r *Result) {
 	e.callbackQueue <- callbackItem{
 		result:      r,
 		destination: c,
+		spanContext: trace.SpanContextFromContext(ctx),
 	}
 }
 
+// Close stops the callback runner, callbacks must not be queued afterward.
+func (e *Engine) Close() {
+	close(e.callbackQueue)
+}
+
 // recycleReader returns the MIME type of input and a new reader
 // containing the whole data from input.
 func recycleReader(input io.Reader) (mimeType string, recycled io.Reader, err error) {
@@ -179,3 +179,33 @@ func BenchmarkEngine(b *testing.B) {
 		}
 	}
 }
+
+func TestAddRule(t *testing.T) {
+	engine, err := New()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	before := engine.RuleCount()
+	engine.AddRule(Rule{Format: "sha1", Content: "24150d6857c158ab2ade806201d573c4442f02bc", Result: "test.added"})
+	if engine.RuleCount() != before+1 {
+		t.Fatalf("expected %d rules, got %d", before+1, engine.RuleCount())
+	}
+
+	result, err := engine.Process(strings.NewReader("added rule"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(result.Findings) != 1 || result.Findings[0] != "test.added" {
+		t.Fatalf("expected finding test.added, got %v", result.Findings)
+	}
+
+	for _, hit := range engine.RuleHits() {
+		want := uint64(0)
+		if hit.Result == "test.added" {
+			want = 1
+		}
+		if hit.Hits != want {
+			t.Fatalf("rule %s: expected %d hits, got %d", hit.Result, want, hit.Hits)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package telemetry
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestSetupDisabled(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Options{})
+	if err != nil {
+		t.Fatalf("setup failed: %s", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %s", err)
+	}
+}
+
+func TestSetupFileAndPropagation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "traces.json")
+	shutdown, err := Setup(context.Background(), Options{File: path, ServiceName: "test"})
+	if err != nil {
+		t.Fatalf("setup failed: %s", err)
+	}
+
+	ctx, span := otel.Tracer("test").Start(context.Background(), "test.span")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost", http.NoBody)
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+	if err := InjectHeaders(ctx, req); err != nil {
+		t.Fatalf("inject failed: %s", err)
+	}
+	if req.Header.Get("traceparent") == "" {
+		t.Fatal("expected traceparent header to be set")
+	}
+
+	extracted := trace.SpanContextFromContext(Extract(context.Background(), req.Header))
+	if extracted.TraceID() != span.SpanContext().TraceID() {
+		t.Fatalf("expected trace id %s, got %s", span.SpanContext().TraceID(), extracted.TraceID())
+	}
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown failed: %s", err)
+	}
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read trace file: %s", err)
+	}
+	if !strings.Contains(string(contents), "test.span") {
+		t.Fatalf("expected trace file to contain the span, got %s", contents)
+	}
+}
@@ -55,6 +55,12 @@ var stdout io.Writer = os.Stdout
 var stderr io.Writer = os.Stderr
 var stdin io.Reader = os.Stdin
 
+// SetOutput redirects regular output to w, used to keep stdout free for
+// machine-readable results. It should be called before anything is printed.
+func SetOutput(w io.Writer) {
+	stdout = w
+}
+
 // ttyOnce caches the TTY detection result.
 var ttyOnce sync.Once
 var ttyResult bool
@@ -105,6 +111,11 @@ func styled(code, text string) string {
 	return code + text + Reset
 }
 
+// Newline prints an empty line.
+func Newline() {
+	_, _ = fmt.Fprintln(stdout)
+}
+
 // Section prints a bold section header: \n:: Title\n
 func Section(title string) {
 	_, _ = fmt.Fprintln(stdout)
@@ -306,3 +317,22 @@ func (s *Spinner) Stop() {
 		}
 	}
 }
+
+// ProgressBytes displays a running byte count for transfers of unknown
+// size. In TTY mode it overwrites the current line, in non-TTY mode it only
+// prints the final line once done is set.
+func ProgressBytes(label string, current uint64, done bool) {
+	stats := FormatBytes(current)
+
+	if !IsTTY() {
+		if done {
+			_, _ = fmt.Fprintf(stdout, "%s %s\n", label, stats)
+		}
+		return
+	}
+
+	_, _ = fmt.Fprintf(stdout, "\r\033[2K%s  %s", label, stats)
+	if done {
+		_, _ = fmt.Fprintln(stdout)
+	}
+}
@@ -227,3 +227,14 @@ func TestToStringEmptyColor(t *testing.T) {
 		t.Fatalf("expected plain text, got %q", result)
 	}
 }
+
+func TestProgressBytesNonTTY(t *testing.T) {
+	out := captureOut(func() {
+		ProgressBytes("Read", 512, false)
+		ProgressBytes("Read", 2048, true)
+	})
+	// only the final count should be printed in non-TTY mode
+	if strings.TrimSpace(out) != "Read 2 KB" {
+		t.Fatalf("expected the final count only, got %q", out)
+	}
+}
@@ -1,8 +1,13 @@
 package vcs
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"os/exec"
 	"runtime/debug"
+	"strconv"
+	"strings"
 )
 
 func Version() string {
@@ -29,3 +34,150 @@ func Version() string {
 
 	return revision
 }
+
+// git runs git in dir and returns its output.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", dir}, args...)...)
+	out, err := cmd.Output()
+	if err != nil {
+		var exit *exec.ExitError
+		if errors.As(err, &exit) && len(exit.Stderr) > 0 {
+			return "", fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(string(exit.Stderr)))
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return string(out), nil
+}
+
+// files runs git in dir and splits its NUL separated list of paths.
+func files(dir string, args ...string) ([]string, error) {
+	out, err := git(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+	var result []string
+	for _, f := range strings.Split(out, "\x00") {
+		if f != "" {
+			result = append(result, f)
+		}
+	}
+	return result, nil
+}
+
+// Commit returns the commit checked out in the git working tree containing
+// dir.
+func Commit(dir string) (string, error) {
+	out, err := git(dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to read git commit of %s: %w", dir, err)
+	}
+	return strings.TrimSpace(out), nil
+}
+
+// Branch returns the branch checked out in the git working tree containing
+// dir, empty when HEAD is detached.
+func Branch(dir string) (string, error) {
+	out, err := git(dir, "rev-parse", "--abbrev-ref", "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("failed to read git branch of %s: %w", dir, err)
+	}
+	if branch := strings.TrimSpace(out); branch != "HEAD" {
+		return branch, nil
+	}
+	return "", nil
+}
+
+// The lists below only hold files that still exist in some form, deleted
+// files are left out. Paths are slash separated, relative to dir and limited
+// to the files under it.
+
+// Staged returns the files added, copied, modified or renamed in the index.
+func Staged(dir string) ([]string, error) {
+	return files(dir, "diff", "--cached", "--name-only", "--diff-filter=ACMR", "--relative", "-z")
+}
+
+// Changed returns the files changed between revisions, written as git diff
+// takes them: a..b, a...b for the changes since a and b diverged, or a
+// single revision compared to the working tree.
+func Changed(dir, revisions string) ([]string, error) {
+	if revisions == "" || strings.HasPrefix(revisions, "-") {
+		return nil, fmt.Errorf("invalid revisions %q", revisions)
+	}
+	return files(dir, "diff", "--name-only", "--diff-filter=ACMR", "--relative", "-z", revisions, "--")
+}
+
+// Untracked returns the files git does not track and does not ignore.
+func Untracked(dir string) ([]string, error) {
+	return files(dir, "ls-files", "--others", "--exclude-standard", "-z")
+}
+
+// Blob streams the content of path as staged in the index of the git
+// repository containing dir, path being slash separated and relative to dir.
+func Blob(dir, path string) (io.ReadCloser, error) {
+	cmd := exec.Command("git", "-C", dir, "cat-file", "blob", ":./"+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, fmt.Errorf("git cat-file: %w", err)
+	}
+	b := &blob{cmd: cmd, stdout: stdout}
+	cmd.Stderr = &b.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("git cat-file: %w", err)
+	}
+	return b, nil
+}
+
+// BlobSize returns the size of path as staged in the index, as Blob reads it.
+func BlobSize(dir, path string) (int64, error) {
+	out, err := git(dir, "cat-file", "-s", ":./"+path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read staged size of %s: %w", path, err)
+	}
+	return strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+}
+
+// blob reads the output of git cat-file, reporting its failure in place of
+// the end of the content.
+type blob struct {
+	cmd    *exec.Cmd
+	stdout io.ReadCloser
+	stderr strings.Builder
+	done   bool
+	err    error
+}
+
+func (b *blob) Read(p []byte) (int, error) {
+	n, err := b.stdout.Read(p)
+	if err == io.EOF {
+		// whether git failed is only known once it exits
+		if werr := b.wait(); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+func (b *blob) wait() error {
+	if b.done {
+		return b.err
+	}
+	b.done = true
+	if err := b.cmd.Wait(); err != nil {
+		if msg := strings.TrimSpace(b.stderr.String()); msg != "" {
+			b.err = fmt.Errorf("git cat-file: %s", msg)
+		} else {
+			b.err = fmt.Errorf("git cat-file: %w", err)
+		}
+	}
+	return b.err
+}
+
+// Close stops git when the content was not read to the end.
+func (b *blob) Close() error {
+	if b.done {
+		return nil
+	}
+	_ = b.stdout.Close()
+	_ = b.wait()
+	return nil
+}
@@ -0,0 +1,189 @@
+// Package scaniitest runs the Scanii mock server in-process so Go tests can
+// exercise a Scanii integration without a network, a binary or an account.
+// It is the library counterpart of the `sc server` command.
+package scaniitest
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/uvasoftware/scanii-cli/internal/commands/server"
+	"github.com/uvasoftware/scanii-cli/internal/engine"
+)
+
+const (
+	// Key is the API key accepted by the mock server.
+	Key = "key"
+	// Secret is the API secret accepted by the mock server.
+	Secret = "secret"
+)
+
+// Server is a running mock Scanii API backed by an httptest.Server.
+type Server struct {
+	// URL is the base URL of the server, e.g. http://127.0.0.1:50000.
+	// API routes live under URL + "/v2.2".
+	URL string
+	// Endpoint is the host:port of the server, suitable for a CLI profile.
+	Endpoint string
+	// Key and Secret are the credentials the server accepts.
+	Key    string
+	Secret string
+	// CallbackURL is a receiver that records every callback delivered by
+	// the server, pass it as the callback of async or fetch requests.
+	CallbackURL string
+
+	engine *engine.Engine
+	data   string
+
+	mu        sync.Mutex
+	callbacks []Callback
+	waited    int
+	// arrived is closed, and replaced, whenever a callback arrives
+	arrived chan struct{}
+}
+
+// Result is a processing result as stored by the mock server.
+type Result struct {
+	ID            string
+	Checksum      string
+	SHA256        string
+	ContentLength uint64
+	ContentType   string
+	Findings      []string
+	CreationDate  string
+	Metadata      map[string]string
+	Error         string
+}
+
+// Callback is a callback payload received from the mock server.
+type Callback struct {
+	ID            string            `json:"id"`
+	Checksum      string            `json:"checksum,omitempty"`
+	ContentLength uint64            `json:"content_length,omitempty"`
+	ContentType   string            `json:"content_type,omitempty"`
+	Findings      []string          `json:"findings"`
+	CreationDate  string            `json:"creation_date,omitempty"`
+	Metadata      map[string]string `json:"metadata,omitempty"`
+	Error         string            `json:"error,omitempty"`
+}
+
+// Start starts a mock server using the built-in engine rules. The server,
+// its storage directory and the callback receiver are released when the
+// test finishes.
+func Start(t testing.TB) *Server {
+	t.Helper()
+
+	eng, err := engine.New()
+	if err != nil {
+		t.Fatalf("scaniitest: could not create engine: %s", err)
+	}
+
+	s := &Server{
+		Key:     Key,
+		Secret:  Secret,
+		engine:  eng,
+		data:    t.TempDir(),
+		arrived: make(chan struct{}),
+	}
+
+	mux := http.NewServeMux()
+	api := httptest.NewServer(server.CORS(mux))
+	server.Setup(mux, eng, s.Key, s.Secret, s.data, api.URL)
+	receiver := httptest.NewServer(http.HandlerFunc(s.receiveCallback))
+
+	t.Cleanup(func() {
+		api.Close()
+		receiver.Close()
+		eng.Close()
+	})
+
+	s.URL = api.URL
+	s.Endpoint = strings.TrimPrefix(api.URL, "http://")
+	s.CallbackURL = receiver.URL
+	return s
+}
+
+// AddRule makes the server report finding for any content whose digest
+// matches. Format is either sha1 or sha256 and digest is lowercase hex.
+func (s *Server) AddRule(format, digest, finding string) {
+	s.engine.AddRule(engine.Rule{Format: format, Content: digest, Result: finding})
+}
+
+// Result returns the stored processing result for id.
+func (s *Server) Result(id string) (*Result, error) {
+	r, err := server.LoadResult(s.data, id)
+	if err != nil {
+		return nil, err
+	}
+	return &Result{
+		ID:            r.ID,
+		Checksum:      r.Sha1,
+		SHA256:        r.Sha256,
+		ContentLength: r.ContentLength,
+		ContentType:   r.ContentType,
+		Findings:      r.Findings,
+		CreationDate:  r.CreationDate,
+		Metadata:      r.Metadata,
+		Error:         r.Error,
+	}, nil
+}
+
+// Callbacks returns every callback received so far, in arrival order.
+func (s *Server) Callbacks() []Callback {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Callback(nil), s.callbacks...)
+}
+
+// WaitForCallback blocks until a callback not yet returned by a previous
+// call arrives and returns it, failing the test if none arrives within
+// timeout.
+func (s *Server) WaitForCallback(t testing.TB, timeout time.Duration) Callback {
+	t.Helper()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		if s.waited < len(s.callbacks) {
+			cb := s.callbacks[s.waited]
+			s.waited++
+			s.mu.Unlock()
+			return cb
+		}
+		arrived := s.arrived
+		s.mu.Unlock()
+
+		select {
+		case <-arrived:
+		case <-timer.C:
+			t.Fatalf("scaniitest: timed out waiting for callback after %s", timeout)
+		}
+	}
+}
+
+func (s *Server) receiveCallback(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	cb := Callback{}
+	if err := json.Unmarshal(body, &cb); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	s.callbacks = append(s.callbacks, cb)
+	close(s.arrived)
+	s.arrived = make(chan struct{})
+	s.mu.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,135 @@
+package scaniitest
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// post sends content as a multipart upload to path with the given extra fields.
+func post(t *testing.T, s *Server, path string, content []byte, fields map[string]string) *http.Response {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	mw := multipart.NewWriter(buf)
+	fw, err := mw.CreateFormFile("file", "payload.bin")
+	if err != nil {
+		t.Fatalf("create form file: %s", err)
+	}
+	if _, err := fw.Write(content); err != nil {
+		t.Fatalf("write file: %s", err)
+	}
+	for k, v := range fields {
+		if err := mw.WriteField(k, v); err != nil {
+			t.Fatalf("write field %s: %s", k, err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatalf("close multipart: %s", err)
+	}
+
+	req, err := http.NewRequestWithContext(t.Context(), http.MethodPost, s.URL+"/v2.2"+path, buf)
+	if err != nil {
+		t.Fatalf("new request: %s", err)
+	}
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	req.SetBasicAuth(s.Key, s.Secret)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("post: %s", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	return resp
+}
+
+func TestStartAndAddRule(t *testing.T) {
+	s := Start(t)
+
+	content := []byte("scaniitest custom rule content")
+	s.AddRule("sha256", fmt.Sprintf("%x", sha256.Sum256(content)), "content.custom.finding")
+
+	resp := post(t, s, "/files", content, map[string]string{"metadata[m1]": "v1"})
+	if resp.StatusCode != http.StatusCreated {
+		raw, _ := io.ReadAll(resp.Body)
+		t.Fatalf("status: want 201, got %d: %s", resp.StatusCode, raw)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+
+	result, err := s.Result(created.ID)
+	if err != nil {
+		t.Fatalf("result: %s", err)
+	}
+	if len(result.Findings) != 1 || result.Findings[0] != "content.custom.finding" {
+		t.Fatalf("expected custom finding, got %v", result.Findings)
+	}
+	if result.Metadata["m1"] != "v1" {
+		t.Fatalf("expected metadata m1=v1, got %v", result.Metadata)
+	}
+	if result.ContentLength != uint64(len(content)) {
+		t.Fatalf("expected content length %d, got %d", len(content), result.ContentLength)
+	}
+}
+
+func TestResultUnknownID(t *testing.T) {
+	s := Start(t)
+	if _, err := s.Result("doesnotexist"); err == nil {
+		t.Fatal("expected error for unknown id")
+	}
+}
+
+func TestCallbacks(t *testing.T) {
+	s := Start(t)
+
+	resp := post(t, s, "/files/async", []byte("callback content"), map[string]string{"callback": s.CallbackURL})
+	if resp.StatusCode != http.StatusAccepted {
+		t.Fatalf("status: want 202, got %d", resp.StatusCode)
+	}
+	var pending struct {
+		ID string `json:"id"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&pending); err != nil {
+		t.Fatalf("decode: %s", err)
+	}
+
+	cb := s.WaitForCallback(t, 5*time.Second)
+	if cb.ID != pending.ID {
+		t.Fatalf("callback id: want %s, got %s", pending.ID, cb.ID)
+	}
+	if cb.Checksum == "" {
+		t.Fatal("expected callback to carry a checksum")
+	}
+	if got := len(s.Callbacks()); got != 1 {
+		t.Fatalf("expected 1 recorded callback, got %d", got)
+	}
+}
+
+func TestWaitForCallbackKeepsEveryArrival(t *testing.T) {
+	s := Start(t)
+
+	// more callbacks than any buffer would hold, none waited for yet
+	const n = 1500
+	for i := range n {
+		body := fmt.Sprintf(`{"id":"%d","findings":[]}`, i)
+		resp, err := http.Post(s.CallbackURL, "application/json", bytes.NewReader([]byte(body))) //nolint:noctx
+		if err != nil {
+			t.Fatalf("post callback: %s", err)
+		}
+		_ = resp.Body.Close()
+	}
+	for i := range n {
+		if cb := s.WaitForCallback(t, time.Second); cb.ID != fmt.Sprint(i) {
+			t.Fatalf("callback %d: got id %s", i, cb.ID)
+		}
+	}
+}